@@ -1,6 +1,7 @@
 package connection 
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -18,6 +19,9 @@ type AESConnection struct {
 	Conn IOChannel 
 	Cypher *AESGCM	
 	Err chan error
+
+	// Conn adapted once, so that its closure is remembered
+	conn IOChannelContext
 }
 
 // NewAESGCM loads the key once and initializes AES-GCM once.
@@ -98,31 +102,61 @@ func FromHex(s string) ([]byte, error) {
 
 func NewAESConnection(conn IOChannel, cypher *AESGCM) *AESConnection {
 	return &AESConnection{
-		conn,
-		cypher,
-		make(chan error, 1),
+		Conn: conn,
+		Cypher: cypher,
+		Err: make(chan error, 1),
+		conn: AdaptIOChannel(conn),
 	}
 }
 
-func (c *AESConnection) Send(b []byte) {
+// Encrypts b and sends it with the nonce appended
+func (c *AESConnection) SendContext(ctx context.Context, b []byte) error {
 	nonce := c.Cypher.GenerateNonce()
 	msg, err := c.Cypher.Encrypt(b, nonce)
-	
 	if err != nil {
-		c.Err <- err
+		return err
+	}
+	return c.conn.SendContext(ctx, slices.Concat(msg, nonce))
+}
+
+// Receives and decrypts a message
+func (c *AESConnection) RecvContext(ctx context.Context) ([]byte, error) {
+	msg, err := c.conn.RecvContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonceOffset := len(msg) - c.Cypher.NonceSize()
+	if nonceOffset < 0 {
+		return nil, errors.New("message too short")
 	}
+	return c.Cypher.Decrypt(msg[:nonceOffset], msg[nonceOffset:])
+}
+
+// Closes the underlying connection
+func (c *AESConnection) Close() error {
+	return c.conn.Close()
+}
 
-	c.Conn.Send(slices.Concat(msg, nonce))
+// Same as SendContext, errors are sent to Err
+func (c *AESConnection) Send(b []byte) {
+	c.reportErr(c.SendContext(context.Background(), b))
 }
 
+// Same as RecvContext, errors are sent to Err
 func (c *AESConnection) Recv() []byte {
-	msg := c.Conn.Recv()
-	nonceOffset := len(msg)-c.Cypher.NonceSize() 
-	nonce := msg[nonceOffset:]
-	plaintext, err := c.Cypher.Decrypt(msg[:nonceOffset], nonce)
-	if err != nil {
-		c.Err <- err
+	plaintext, err := c.RecvContext(context.Background())
+	c.reportErr(err)
+	return plaintext
+}
+
+// Sends err to Err, dropping it if Err is full
+func (c *AESConnection) reportErr(err error) {
+	if err == nil {
+		return
+	}
+	select {
+	case c.Err <- err:
+	default:
 	}
-	return plaintext	
 }
 
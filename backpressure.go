@@ -0,0 +1,138 @@
+package connection
+
+import (
+	"errors"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	DefaultMaxBufferedAmount uint64 = 1 << 20
+	DefaultLowBufferedAmount uint64 = 256 << 10
+)
+
+// Returned by TrySend when the input buffer is full
+var ErrWouldBlock = errors.New("Send would block")
+
+// High and low water marks of the settings, with defaults
+func (s *ConnectionSettings) waterMarks() (uint64, uint64) {
+	high, low := s.MaxBufferedAmount, s.LowBufferedAmount
+	if high == 0 {
+		high = DefaultMaxBufferedAmount
+	}
+	if low == 0 || low > high {
+		low = min(DefaultLowBufferedAmount, high/4)
+	}
+	return high, low
+}
+
+// Parameters of a sendLoop
+type sendOptions struct {
+	// buffered amount water marks
+	high, low uint64
+	// messages larger than maxSize are dropped, see messageLimit
+	maxSize int
+	// stops the loop
+	done <-chan struct{}
+	// stops the loop once the messages already queued have been sent,
+	// nil for never
+	stop <-chan struct{}
+	// receives the non fatal errors
+	report func(error)
+}
+
+// Options for the data channels of a connection
+func (c *Connection) sendOptions(done <-chan struct{}, stop <-chan struct{}) sendOptions {
+	high, low := c.Settings.waterMarks()
+	return sendOptions{
+		high: high,
+		low: low,
+		maxSize: c.Settings.maxMessageSize(),
+		done: done,
+		stop: stop,
+		report: func(err error) { c.report(PhaseDataChannel, err) },
+	}
+}
+
+// Sends the messages read from in through dc until opts.done is closed,
+// or opts.stop is closed and in is empty.
+// Messages are split in frames if dc is reliable.
+// Whenever the data buffered by dc exceeds high, waits for it to drop
+// to low before sending again, so that a slow peer makes in fill up
+// and Send block.
+// Returns the first send error, or an error if dc stops being open
+// while waiting.
+func sendLoop(dc *webrtc.DataChannel, in chan []byte, opts sendOptions) error {
+	split := reliable(dc)
+	limit := messageLimit(dc, opts.maxSize)
+	drained := make(chan struct{}, 1)
+	dc.SetBufferedAmountLowThreshold(opts.low)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case drained <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		var msg []byte
+		// done wins over the queued messages
+		select {
+		case <-opts.done:
+			return nil
+		default:
+		}
+		select {
+		case msg = <-in:
+		case <-opts.stop:
+			// send what is left
+			select {
+			case msg = <-in:
+			default:
+				return nil
+			}
+		case <-opts.done:
+			return nil
+		}
+		if len(msg) > limit {
+			// written to in directly, past the checks of SendContext
+			opts.report(ErrMessageTooLarge)
+			continue
+		}
+		for _, frame := range frames(msg, split) {
+			if err := dc.Send(frame); err != nil {
+				return err
+			}
+			for dc.BufferedAmount() > opts.high {
+				select {
+				case <-drained:
+				case <-opts.done:
+					return nil
+				case <-time.After(100 * time.Millisecond):
+					if dc.ReadyState() != webrtc.DataChannelStateOpen {
+						return errors.New("Data channel " + dc.Label() + " is " + dc.ReadyState().String())
+					}
+				}
+			}
+		}
+	}
+}
+
+// Same as SendContext, but returns ErrWouldBlock instead of blocking
+// when the peer is not keeping up
+func (c *Connection) TrySend(b []byte) error {
+	if len(b) > c.Settings.maxMessageSize() {
+		return ErrMessageTooLarge
+	}
+	return trySend(c.In, c.stop, b)
+}
+
+// Same as SendContext, but returns ErrWouldBlock instead of blocking
+// when the peer is not keeping up
+func (ch *Channel) TrySend(b []byte) error {
+	if len(b) > ch.maxSize() {
+		return ErrMessageTooLarge
+	}
+	return trySend(ch.In, ch.closed, b)
+}
@@ -0,0 +1,70 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackpressure(t *testing.T) {
+	const high = 64 << 10
+	const size = 16 << 10
+	offerer, answerer := connectPair(t, ConnectionSettings{
+		Key: "backpressure",
+		MaxBufferedAmount: high,
+		LowBufferedAmount: 16 << 10,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sender, err := offerer.OpenChannel("bulk", nil)
+	if err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	receiver, err := answerer.AcceptChannel(ctx, "bulk")
+	if err != nil {
+		t.Fatalf("Channel not received: %v", err)
+	}
+
+	// the receiver does not read: sending must stall
+	sent := 0
+	for {
+		err := sender.TrySend(bytes.Repeat([]byte{byte(sent)}, size))
+		if errors.Is(err, ErrWouldBlock) {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Sending never blocked")
+		}
+		if buffered := sender.DataChannel().BufferedAmount(); buffered > high+size {
+			t.Fatalf("Buffered amount %d exceeds the high water mark", buffered)
+		}
+		sent++
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if buffered := sender.DataChannel().BufferedAmount(); buffered > high+size {
+		t.Fatalf("Buffered amount %d exceeds the high water mark", buffered)
+	}
+
+	// everything is delivered once the receiver catches up
+	for i := 0; i < sent; i++ {
+		msg := receiver.Recv()
+		if len(msg) != size || msg[0] != byte(i) {
+			t.Fatalf("Message %d corrupted or out of order", i)
+		}
+	}
+}
+
+func TestWaterMarks(t *testing.T) {
+	high, low := (&ConnectionSettings{}).waterMarks()
+	if high != DefaultMaxBufferedAmount || low != DefaultLowBufferedAmount {
+		t.Errorf("Unexpected defaults %d %d", high, low)
+	}
+	high, low = (&ConnectionSettings{MaxBufferedAmount: 1000}).waterMarks()
+	if high != 1000 || low != 250 {
+		t.Errorf("Unexpected water marks %d %d", high, low)
+	}
+}
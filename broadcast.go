@@ -0,0 +1,70 @@
+package connection
+
+import "sync"
+
+// Fan-out of events to subscribers, never blocking the sender: when a
+// subscriber falls behind its oldest events are dropped.
+type broadcaster[T any] struct {
+	// subscribers by id, nil once closed
+	subs map[int]chan T
+	next int
+	mu   sync.Mutex
+}
+
+func newBroadcaster[T any]() *broadcaster[T] {
+	return &broadcaster[T]{subs: make(map[int]chan T)}
+}
+
+// Adds a subscriber buffering up to size events.
+// The channel is closed by cancel or by close.
+func (b *broadcaster[T]) subscribe(size int) (<-chan T, func()) {
+	ch := make(chan T, max(size, 1))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		close(ch)
+		return ch, func() {}
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = ch
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if sub, ok := b.subs[id]; ok {
+			delete(b.subs, id)
+			close(sub)
+		}
+	}
+}
+
+// Sends ev to all the subscribers, without blocking
+func (b *broadcaster[T]) publish(ev T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		for sent := false; !sent; {
+			select {
+			case sub <- ev:
+				sent = true
+			default:
+				// drop the oldest event
+				select {
+				case <-sub:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// Closes the subscriptions, later ones are closed immediately
+func (b *broadcaster[T]) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subs {
+		close(sub)
+	}
+	b.subs = nil
+}
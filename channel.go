@@ -0,0 +1,222 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Label of the data channel bound to Connection.In and Connection.Out
+const DefaultLabel = "data"
+
+// A named data channel of a Connection, with its own IO buffers.
+// A channel is opened by one side with Connection.OpenChannel
+// and obtained on the other side with Connection.AcceptChannel.
+type Channel struct {
+	Label string
+
+	// IO buffers
+	// channel output (receive from remote)
+	Out chan []byte
+	// channel input (send to remote)
+	In chan []byte
+
+	dc *webrtc.DataChannel
+	conn *Connection
+	opts sendOptions
+	// guard of Out
+	out output
+	// closed when the data channel opens
+	opened chan struct{}
+	// closed by Close
+	closed chan struct{}
+	closeOnce sync.Once
+	mu sync.Mutex
+}
+
+func newChannel(label string, c *Connection) *Channel {
+	ch := &Channel{
+		Label: label,
+		Out: make(chan []byte, c.Settings.BufferSize),
+		In: make(chan []byte, c.Settings.BufferSize),
+		opened: make(chan struct{}),
+		closed: make(chan struct{}),
+		conn: c,
+	}
+	ch.opts = c.sendOptions(ch.closed, nil)
+	return ch
+}
+
+// Returns the channel with the given label, creating it if needed
+func (c *Connection) channel(label string) *Channel {
+	c.chmu.Lock()
+	defer c.chmu.Unlock()
+	ch, ok := c.channels[label]
+	if !ok {
+		ch = newChannel(label, c)
+		c.channels[label] = ch
+	}
+	return ch
+}
+
+// Opens a new data channel towards the remote peer.
+// options set the reliability of the channel (nil means reliable and ordered),
+// e.g. {Ordered: false, MaxRetransmits: 0} for lossy telemetry.
+// Either peer can open channels, but a given label must be opened by one side only.
+func (c *Connection) OpenChannel(label string, options *webrtc.DataChannelInit) (*Channel, error) {
+	if label == DefaultLabel {
+		return nil, errors.New("Label " + label + " is reserved")
+	}
+	dc, err := c.peer.CreateDataChannel(label, options)
+	if err != nil {
+		return nil, err
+	}
+	ch := c.channel(label)
+	if err := ch.attach(dc); err != nil {
+		dc.Close()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Waits for the remote peer to open the channel with the given label.
+// Returns once the channel is open or ctx is done.
+func (c *Connection) AcceptChannel(ctx context.Context, label string) (*Channel, error) {
+	if label == DefaultLabel {
+		return nil, errors.New("Label " + label + " is reserved")
+	}
+	ch := c.channel(label)
+	if err := ch.WaitOpen(ctx); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// Dispatches the data channels opened by the remote peer
+func (c *Connection) onDataChannel(dc *webrtc.DataChannel) {
+	if dc.Label() == DefaultLabel {
+		c.AttachFunctionality(dc)
+		return
+	}
+	if err := c.channel(dc.Label()).attach(dc); err != nil {
+		c.report(PhaseDataChannel, err)
+		dc.Close()
+	}
+}
+
+// Connects In and Out to dc
+func (ch *Channel) attach(dc *webrtc.DataChannel) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.dc != nil {
+		return errors.New("Channel " + ch.Label + " already exists")
+	}
+	ch.dc = dc
+
+	// closed by the remote peer: unblock Recv and the send loop
+	ch.conn.watchDataChannel(dc, func() { ch.Close() })
+	dc.OnOpen(func() {
+		close(ch.opened)
+		ch.conn.publish(StateEvent{Kind: StateDataChannel, DataChannel: webrtc.DataChannelStateOpen, Label: dc.Label()})
+		// send
+		if err := sendLoop(dc, ch.In, ch.opts); err != nil {
+			ch.opts.report(err)
+			ch.Close()
+		}
+	})
+
+	r := reassembler{max: ch.opts.maxSize}
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		//receive
+		data, ok, err := r.push(msg.Data)
+		if err != nil {
+			ch.opts.report(err)
+		}
+		if ok {
+			ch.out.deliver(ch.Out, ch.closed, data)
+		}
+	})
+	return nil
+}
+
+// Blocks until the channel is open or ctx is done
+func (ch *Channel) WaitOpen(ctx context.Context) error {
+	select {
+	case <-ch.opened:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Underlying data channel, nil until the channel
+// has been opened or received
+func (ch *Channel) DataChannel() *webrtc.DataChannel {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.dc
+}
+
+// Sends b, dropping it if the channel is closed.
+// Too large messages are reported to Settings.OnError
+func (ch *Channel) Send(b []byte) {
+	if err := ch.SendContext(context.Background(), b); errors.Is(err, ErrMessageTooLarge) {
+		ch.opts.report(err)
+	}
+}
+
+func (ch *Channel) Recv() []byte {
+	return <-ch.Out
+}
+
+// Same as Send, but returns net.ErrClosed if the channel is closed,
+// ErrMessageTooLarge if b exceeds Settings.MaxMessageSize (or, on
+// unreliable channels, the SCTP message size) and ctx.Err() if ctx
+// is done first
+func (ch *Channel) SendContext(ctx context.Context, b []byte) error {
+	if len(b) > ch.maxSize() {
+		return ErrMessageTooLarge
+	}
+	return sendContext(ctx, ch.In, ch.closed, b)
+}
+
+// Largest message accepted by the channel.
+// Until the data channel exists, only the maximum message size is known
+func (ch *Channel) maxSize() int {
+	if dc := ch.DataChannel(); dc != nil {
+		return messageLimit(dc, ch.opts.maxSize)
+	}
+	return ch.opts.maxSize
+}
+
+// Same as Recv, but returns io.EOF once the channel is closed,
+// and ctx.Err() if ctx is done first
+func (ch *Channel) RecvContext(ctx context.Context) ([]byte, error) {
+	select {
+	case msg, ok := <-ch.Out:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Closes the data channel and Out. In is left open, but not read anymore.
+// Subsequent calls have no effect. Called as well when the remote peer
+// closes the channel.
+func (ch *Channel) Close() error {
+	var err error
+	ch.closeOnce.Do(func() {
+		close(ch.closed)
+		ch.out.close(ch.Out)
+		if dc := ch.DataChannel(); dc != nil {
+			err = dc.Close()
+		}
+	})
+	return err
+}
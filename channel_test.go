@@ -0,0 +1,105 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestChannels(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "channels"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var zero uint16
+	control, err := offerer.OpenChannel("control", nil)
+	if err != nil {
+		t.Fatalf("Cannot open control channel: %v", err)
+	}
+	telemetry, err := offerer.OpenChannel("telemetry", &webrtc.DataChannelInit{
+		Ordered: new(bool),
+		MaxRetransmits: &zero,
+	})
+	if err != nil {
+		t.Fatalf("Cannot open telemetry channel: %v", err)
+	}
+	// opened by the answerer
+	events, err := answerer.OpenChannel("events", nil)
+	if err != nil {
+		t.Fatalf("Cannot open events channel: %v", err)
+	}
+
+	remoteTelemetry, err := answerer.AcceptChannel(ctx, "telemetry")
+	if err != nil {
+		t.Fatalf("Telemetry channel not received: %v", err)
+	}
+	remoteControl, err := answerer.AcceptChannel(ctx, "control")
+	if err != nil {
+		t.Fatalf("Control channel not received: %v", err)
+	}
+	remoteEvents, err := offerer.AcceptChannel(ctx, "events")
+	if err != nil {
+		t.Fatalf("Events channel not received: %v", err)
+	}
+
+	dc := remoteTelemetry.DataChannel()
+	if dc.Ordered() || dc.MaxRetransmits() == nil || *dc.MaxRetransmits() != 0 {
+		t.Errorf("Telemetry channel should be unordered without retransmissions")
+	}
+	if !remoteControl.DataChannel().Ordered() {
+		t.Errorf("Control channel should be ordered")
+	}
+
+	pairs := []struct{ local, remote IOChannel }{
+		{control, remoteControl},
+		{telemetry, remoteTelemetry},
+		{events, remoteEvents},
+		{offerer, answerer},
+	}
+	for _, p := range pairs {
+		payload := []byte("hello")
+		p.local.Send(payload)
+		if recv := p.remote.Recv(); !slices.Equal(recv, payload) {
+			t.Errorf("Expected %s, got %s", payload, recv)
+		}
+	}
+}
+
+func TestReservedLabel(t *testing.T) {
+	c := CreateConnection(&ConnectionSettings{BufferSize: 1})
+	if _, err := c.OpenChannel(DefaultLabel, nil); err == nil {
+		t.Errorf("Opening the default label should fail")
+	}
+}
+
+func TestChannelRemoteClose(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "channel-close"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	local, err := offerer.OpenChannel("closing", nil)
+	if err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	remote, err := answerer.AcceptChannel(ctx, "closing")
+	if err != nil {
+		t.Fatalf("Channel not received: %v", err)
+	}
+	if err := local.WaitOpen(ctx); err != nil {
+		t.Fatalf("Channel not open: %v", err)
+	}
+
+	local.Close()
+	if _, err := remote.RecvContext(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+	if err := remote.SendContext(ctx, []byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
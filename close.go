@@ -0,0 +1,92 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Time given by Close to flush the pending messages
+const CloseTimeout = 5 * time.Second
+
+// Closes the connection gracefully: stops accepting new messages, sends
+// the ones still queued in In, waits for the data channel to hand them
+// all to the network, then tells the remote peer, whose Recv returns nil
+// once the messages have been received.
+// Messages sent during or after Close are dropped (SendContext
+// returns net.ErrClosed).
+// Gives up flushing after CloseTimeout.
+func (c *Connection) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), CloseTimeout)
+	defer cancel()
+	return c.CloseContext(ctx)
+}
+
+// Same as Close, but flushes until ctx is done.
+// The connection is closed in any case; the error tells whether
+// the pending messages could be flushed.
+func (c *Connection) CloseContext(ctx context.Context) error {
+	c.mu.Lock()
+	if c.IsClosed || c.closing {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closing = true
+	close(c.stop)
+	dc := c.dc
+	c.mu.Unlock()
+
+	err := c.flush(ctx, dc)
+	if cerr := c.CloseAll(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Sends the queued messages and the close notification through dc
+func (c *Connection) flush(ctx context.Context, dc *webrtc.DataChannel) error {
+	select {
+	case <-c.opened:
+	default:
+		// nothing has been sent, nobody to tell
+		return nil
+	}
+
+	// the send loop returns once In is drained
+	select {
+	case <-c.sendDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := waitDrained(ctx, dc); err != nil {
+		return err
+	}
+	if err := dc.Send([]byte{frameClose}); err != nil {
+		return err
+	}
+	err := waitDrained(ctx, dc)
+	if dc.ReadyState() != webrtc.DataChannelStateOpen {
+		// closed by the remote peer after the notification
+		return nil
+	}
+	return err
+}
+
+// Blocks until dc has no buffered data
+func waitDrained(ctx context.Context, dc *webrtc.DataChannel) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for dc.BufferedAmount() > 0 {
+		if dc.ReadyState() != webrtc.DataChannelStateOpen {
+			return errors.New("Data channel " + dc.Label() + " is " + dc.ReadyState().String())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package connection
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestGracefulClose(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "close", BufferSize: 64})
+
+	const count = 50
+	payload := bytes.Repeat([]byte{'x'}, 100<<10)
+	for range count {
+		offerer.Send(payload)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- offerer.Close() }()
+
+	received := 0
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-answerer.Out:
+			if !ok {
+				if received != count {
+					t.Fatalf("Expected %d messages before the end of stream, got %d", count, received)
+				}
+				if err := <-closed; err != nil {
+					t.Errorf("Cannot close: %v", err)
+				}
+				if answerer.Err() != nil {
+					t.Errorf("Remote should be closed cleanly, got %v", answerer.Err())
+				}
+				if answerer.Recv() != nil {
+					t.Errorf("Recv should return nil after the end of stream")
+				}
+				return
+			}
+			if !bytes.Equal(msg, payload) {
+				t.Fatalf("Corrupted message")
+			}
+			received++
+		case <-timeout:
+			t.Fatalf("End of stream not received after %d messages", received)
+		}
+	}
+}
+
+func TestCloseBeforeOpen(t *testing.T) {
+	settings := &ConnectionSettings{BufferSize: 1}
+	c := CreateConnection(settings)
+	if err := c.Close(); err != nil {
+		t.Errorf("Cannot close: %v", err)
+	}
+	if !c.IsClosed {
+		t.Errorf("Connection should be closed")
+	}
+}
@@ -0,0 +1,377 @@
+package connection
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// Prefix of the environment variables overriding the configuration
+const EnvPrefix = "DIRECTCHAN_"
+
+// Configuration of a client, as read by LoadConfig, e.g. in TOML:
+//
+//	signaling = "ws://example.com:8080"
+//	key = "secret-key"
+//	stun = ["stun:stun.l.google.com:19302"]
+//	reconnect = true
+//
+//	[heartbeat]
+//	interval = "2s"
+//
+// Every field can be overridden by the environment variable named after
+// its env tag, with EnvPrefix: e.g. DIRECTCHAN_KEY, DIRECTCHAN_HEARTBEAT_INTERVAL.
+// Lists are comma separated in the environment.
+type Config struct {
+	Signaling      string   `json:"signaling" toml:"signaling" env:"SIGNALING"`
+	Key            string   `json:"key" toml:"key" env:"KEY"`
+	STUN           []string `json:"stun" toml:"stun" env:"STUN"`
+	TURN           string   `json:"turn" toml:"turn" env:"TURN"`
+	TURNUsername   string   `json:"turn_username" toml:"turn_username" env:"TURN_USERNAME"`
+	TURNCredential string   `json:"turn_credential" toml:"turn_credential" env:"TURN_CREDENTIAL"`
+	// "all" (default) or "relay"
+	ICETransportPolicy string `json:"ice_transport_policy" toml:"ice_transport_policy" env:"ICE_TRANSPORT_POLICY"`
+	BufferSize         uint   `json:"buffer_size" toml:"buffer_size" env:"BUFFER_SIZE"`
+	MaxMessageSize     uint   `json:"max_message_size" toml:"max_message_size" env:"MAX_MESSAGE_SIZE"`
+	MaxBufferedAmount  uint64 `json:"max_buffered_amount" toml:"max_buffered_amount" env:"MAX_BUFFERED_AMOUNT"`
+	LowBufferedAmount  uint64 `json:"low_buffered_amount" toml:"low_buffered_amount" env:"LOW_BUFFERED_AMOUNT"`
+	// Use DefaultReconnectPolicy, true by default
+	Reconnect bool            `json:"reconnect" toml:"reconnect" env:"RECONNECT"`
+	Heartbeat HeartbeatConfig `json:"heartbeat" toml:"heartbeat" env:"HEARTBEAT_"`
+	Network   NetworkConfig   `json:"network" toml:"network" env:"NETWORK_"`
+	// PEM file of the local certificate, created if missing
+	Certificate         string   `json:"certificate" toml:"certificate" env:"CERTIFICATE"`
+	TrustedFingerprints []string `json:"trusted_fingerprints" toml:"trusted_fingerprints" env:"TRUSTED_FINGERPRINTS"`
+	// Level of the logs written to stderr (debug, info, warn or error),
+	// empty disables logging
+	LogLevel string `json:"log_level" toml:"log_level" env:"LOG_LEVEL"`
+}
+
+// Heartbeat options, see HeartbeatPolicy. Disabled if Interval is zero
+type HeartbeatConfig struct {
+	Interval  Duration `json:"interval" toml:"interval" env:"INTERVAL"`
+	MaxMissed int      `json:"max_missed" toml:"max_missed" env:"MAX_MISSED"`
+	Close     bool     `json:"close" toml:"close" env:"CLOSE"`
+}
+
+// ICE options, see NetworkSettings
+type NetworkConfig struct {
+	PortMin uint16 `json:"port_min" toml:"port_min" env:"PORT_MIN"`
+	PortMax uint16 `json:"port_max" toml:"port_max" env:"PORT_MAX"`
+	// udp4, udp6, tcp4 or tcp6
+	Types []string `json:"types" toml:"types" env:"TYPES"`
+	// Names of the interfaces to use, empty means all
+	Interfaces      []string `json:"interfaces" toml:"interfaces" env:"INTERFACES"`
+	IncludeLoopback bool     `json:"include_loopback" toml:"include_loopback" env:"INCLUDE_LOOPBACK"`
+	NAT1To1IPs      []string `json:"nat_1to1_ips" toml:"nat_1to1_ips" env:"NAT_1TO1_IPS"`
+	// disabled, query or gather
+	MDNS                string   `json:"mdns" toml:"mdns" env:"MDNS"`
+	DisconnectedTimeout Duration `json:"disconnected_timeout" toml:"disconnected_timeout" env:"DISCONNECTED_TIMEOUT"`
+	FailedTimeout       Duration `json:"failed_timeout" toml:"failed_timeout" env:"FAILED_TIMEOUT"`
+	KeepAliveInterval   Duration `json:"keepalive_interval" toml:"keepalive_interval" env:"KEEPALIVE_INTERVAL"`
+}
+
+// time.Duration written as a string, e.g. "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	*d = Duration(parsed)
+	return err
+}
+
+// Configuration used when no file is given
+func DefaultConfig() *Config {
+	return &Config{
+		STUN:       []string{"stun:stun.l.google.com:19302"},
+		BufferSize: 16,
+		// recover from disconnections, closes on failure
+		Reconnect: true,
+	}
+}
+
+// Reads the configuration from a JSON or TOML file (by extension) over
+// DefaultConfig, then applies the environment variables, and validates it.
+// An empty path means the environment only.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		if err := DecodeConfigFile(path, config); err != nil {
+			return nil, err
+		}
+	}
+	if err := ApplyEnv(config); err != nil {
+		return nil, err
+	}
+	return config, config.Validate()
+}
+
+// Decodes a JSON or TOML file into v, failing on unknown fields
+func DecodeConfigFile(path string, v any) error {
+	switch filepath.Ext(path) {
+	case ".json":
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		decoder := json.NewDecoder(f)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(v); err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	case ".toml":
+		meta, err := toml.DecodeFile(path, v)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return errors.New(path + ": unknown field " + undecoded[0].String())
+		}
+	default:
+		return errors.New("Unsupported configuration file " + path + ", expected .json or .toml")
+	}
+	return nil
+}
+
+// Sets the fields of the struct pointed by v having an env tag from
+// the environment variables named EnvPrefix + tag, when defined.
+// Tags of nested structs are prefixes of the tags of their fields.
+func ApplyEnv(v any) error {
+	return applyEnv(reflect.ValueOf(v).Elem(), EnvPrefix)
+}
+
+var textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+func applyEnv(v reflect.Value, prefix string) error {
+	for i := range v.NumField() {
+		field, tag := v.Field(i), v.Type().Field(i).Tag.Get("env")
+		if tag == "" {
+			continue
+		}
+		name := prefix + tag
+		if field.Kind() == reflect.Struct && !field.Addr().Type().Implements(textUnmarshaler) {
+			if err := applyEnv(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return errors.New("Invalid " + name + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Parses value into field
+func setField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return errors.New("Unsupported type " + field.Type().String())
+		}
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return errors.New("Unsupported type " + field.Type().String())
+	}
+	return nil
+}
+
+// Checks the configuration, reporting all the invalid fields
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(msg string) { errs = append(errs, errors.New(msg)) }
+
+	if c.Signaling != "" {
+		if !strings.HasPrefix(c.Signaling, "ws://") && !strings.HasPrefix(c.Signaling, "wss://") {
+			invalid("signaling must be a ws:// or wss:// address")
+		}
+		if c.Key == "" {
+			invalid("key is required with a signaling server")
+		}
+	}
+	if c.TURN == "" && (c.TURNUsername != "" || c.TURNCredential != "") {
+		invalid("turn credentials without turn server")
+	}
+	if _, err := c.iceTransportPolicy(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.BufferSize == 0 {
+		invalid("buffer_size must be greater than 0")
+	}
+	if c.MaxBufferedAmount != 0 && c.LowBufferedAmount > c.MaxBufferedAmount {
+		invalid("low_buffered_amount must not exceed max_buffered_amount")
+	}
+	if c.Heartbeat.Interval < 0 || c.Heartbeat.MaxMissed < 0 {
+		invalid("heartbeat interval and max_missed must not be negative")
+	}
+	if c.Network.PortMin > c.Network.PortMax {
+		invalid("network port_min must not exceed port_max")
+	}
+	if _, err := c.Network.networkTypes(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.Network.mdnsMode(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, f := range c.TrustedFingerprints {
+		if len(strings.Fields(f)) != 2 {
+			invalid("trusted fingerprint " + strconv.Quote(f) + " must be \"<algorithm> <value>\"")
+		}
+	}
+	if c.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			invalid("invalid log_level " + c.LogLevel)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Builds the settings of a connection, loading the certificate
+func (c *Config) Settings() (*ConnectionSettings, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	policy, _ := c.iceTransportPolicy()
+	types, _ := c.Network.networkTypes()
+	mdns, _ := c.Network.mdnsMode()
+	settings := &ConnectionSettings{
+		Signaling:           c.Signaling,
+		Key:                 c.Key,
+		STUN:                c.STUN,
+		TURN:                c.TURN,
+		TURNUsername:        c.TURNUsername,
+		TURNCredential:      c.TURNCredential,
+		ICETransportPolicy:  policy,
+		BufferSize:          c.BufferSize,
+		MaxMessageSize:      c.MaxMessageSize,
+		MaxBufferedAmount:   c.MaxBufferedAmount,
+		LowBufferedAmount:   c.LowBufferedAmount,
+		TrustedFingerprints: c.TrustedFingerprints,
+		Network: &NetworkSettings{
+			PortMin:             c.Network.PortMin,
+			PortMax:             c.Network.PortMax,
+			NetworkTypes:        types,
+			IncludeLoopback:     c.Network.IncludeLoopback,
+			NAT1To1IPs:          c.Network.NAT1To1IPs,
+			MDNSMode:            mdns,
+			DisconnectedTimeout: time.Duration(c.Network.DisconnectedTimeout),
+			FailedTimeout:       time.Duration(c.Network.FailedTimeout),
+			KeepAliveInterval:   time.Duration(c.Network.KeepAliveInterval),
+		},
+	}
+	if interfaces := c.Network.Interfaces; len(interfaces) > 0 {
+		settings.Network.InterfaceFilter = func(name string) bool {
+			return slices.Contains(interfaces, name)
+		}
+	}
+	if c.Reconnect {
+		settings.Reconnect = DefaultReconnectPolicy()
+	}
+	if c.Heartbeat.Interval > 0 {
+		settings.Heartbeat = &HeartbeatPolicy{
+			Interval:  time.Duration(c.Heartbeat.Interval),
+			MaxMissed: c.Heartbeat.MaxMissed,
+			Close:     c.Heartbeat.Close,
+		}
+	}
+	if c.Certificate != "" {
+		cert, err := LoadOrCreateCertificate(c.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		settings.Certificate = cert
+	}
+	if c.LogLevel != "" {
+		var level slog.Level
+		level.UnmarshalText([]byte(c.LogLevel))
+		settings.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+	return settings, nil
+}
+
+func (c *Config) iceTransportPolicy() (webrtc.ICETransportPolicy, error) {
+	switch c.ICETransportPolicy {
+	case "", "all":
+		return webrtc.ICETransportPolicyAll, nil
+	case "relay":
+		return webrtc.ICETransportPolicyRelay, nil
+	}
+	return 0, errors.New("ice_transport_policy must be all or relay")
+}
+
+func (n *NetworkConfig) networkTypes() ([]webrtc.NetworkType, error) {
+	var types []webrtc.NetworkType
+	for _, raw := range n.Types {
+		typ, err := webrtc.NewNetworkType(raw)
+		if err != nil {
+			return nil, errors.New("network type " + raw + " must be udp4, udp6, tcp4 or tcp6")
+		}
+		types = append(types, typ)
+	}
+	return types, nil
+}
+
+func (n *NetworkConfig) mdnsMode() (ice.MulticastDNSMode, error) {
+	switch n.MDNS {
+	case "":
+		return 0, nil
+	case "disabled":
+		return ice.MulticastDNSModeDisabled, nil
+	case "query":
+		return ice.MulticastDNSModeQueryOnly, nil
+	case "gather":
+		return ice.MulticastDNSModeQueryAndGather, nil
+	}
+	return 0, errors.New("network mdns must be disabled, query or gather")
+}
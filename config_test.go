@@ -0,0 +1,118 @@
+package connection
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// Writes content to a file named name in a temporary directory
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	path := writeConfig(t, "client.toml", `
+signaling = "ws://localhost:8080"
+key = "from-file"
+buffer_size = 4
+ice_transport_policy = "relay"
+
+[heartbeat]
+interval = "1s"
+close = true
+
+[network]
+types = ["udp4"]
+mdns = "disabled"
+port_min = 5000
+port_max = 5010
+`)
+	t.Setenv("DIRECTCHAN_KEY", "from-env")
+	t.Setenv("DIRECTCHAN_STUN", "stun:a, stun:b")
+	t.Setenv("DIRECTCHAN_HEARTBEAT_MAX_MISSED", "5")
+	t.Setenv("DIRECTCHAN_NETWORK_FAILED_TIMEOUT", "30s")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Cannot load config: %v", err)
+	}
+	settings, err := config.Settings()
+	if err != nil {
+		t.Fatalf("Cannot build settings: %v", err)
+	}
+	if settings.Key != "from-env" || settings.Signaling != "ws://localhost:8080" || settings.BufferSize != 4 {
+		t.Errorf("Unexpected settings %+v", settings)
+	}
+	if len(settings.STUN) != 2 || settings.STUN[1] != "stun:b" {
+		t.Errorf("Unexpected STUN servers %v", settings.STUN)
+	}
+	if settings.ICETransportPolicy != webrtc.ICETransportPolicyRelay {
+		t.Errorf("Unexpected transport policy %v", settings.ICETransportPolicy)
+	}
+	if settings.Reconnect == nil {
+		t.Errorf("Reconnection should be enabled by default")
+	}
+	if hb := settings.Heartbeat; hb == nil || hb.Interval != time.Second || hb.MaxMissed != 5 || !hb.Close {
+		t.Errorf("Unexpected heartbeat %+v", hb)
+	}
+	network := settings.Network
+	if len(network.NetworkTypes) != 1 || network.NetworkTypes[0] != webrtc.NetworkTypeUDP4 ||
+		network.MDNSMode != ice.MulticastDNSModeDisabled ||
+		network.PortMin != 5000 || network.PortMax != 5010 ||
+		network.FailedTimeout != 30*time.Second {
+		t.Errorf("Unexpected network settings %+v", network)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := writeConfig(t, "client.json", `{"key": "json", "reconnect": false, "trusted_fingerprints": ["sha-256 AB:CD"]}`)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Cannot load config: %v", err)
+	}
+	if config.Key != "json" || config.Reconnect || len(config.TrustedFingerprints) != 1 || config.BufferSize != 16 {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	path = writeConfig(t, "typo.json", `{"buffersize": 4}`)
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+	if _, err := LoadConfig(writeConfig(t, "client.yaml", "")); err == nil {
+		t.Errorf("Expected an error for an unsupported extension")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Setenv("DIRECTCHAN_BUFFER_SIZE", "many")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "DIRECTCHAN_BUFFER_SIZE") {
+		t.Errorf("Expected an error for DIRECTCHAN_BUFFER_SIZE, got %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Signaling = "http://localhost"
+	config.BufferSize = 0
+	config.Network.PortMin = 10
+	config.Network.Types = []string{"sctp"}
+	config.LogLevel = "loud"
+	err := config.Validate()
+	if err == nil {
+		t.Fatalf("Expected validation errors")
+	}
+	for _, field := range []string{"signaling", "key", "buffer_size", "port_min", "sctp", "log_level"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Missing error about %s in %v", field, err)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package connection
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"io"
+	"log/slog"
+	"net"
 	"sync"
+	"sync/atomic"
 
-	ws "github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -14,9 +17,49 @@ import (
 type ConnectionSettings struct {
 	Signaling string // address of the signaling server ("ws://<ip>:<port>")
 	STUN []string
-	TURN string
+	TURN string // address of the TURN server ("turn:<ip>:<port>")
+	TURNUsername string
+	TURNCredential string
+	ICEServers []webrtc.ICEServer // additional STUN/TURN servers
+	// Candidates allowed for the connection.
+	// Use webrtc.ICETransportPolicyRelay to only connect through TURN
+	ICETransportPolicy webrtc.ICETransportPolicy
 	Key string // Channel's identifier
 	BufferSize uint // Size in bytes of the output/input buffers
+	// Sending pauses while a data channel buffers more than MaxBufferedAmount
+	// bytes and resumes once it drops to LowBufferedAmount.
+	// Zero values mean DefaultMaxBufferedAmount and DefaultLowBufferedAmount
+	MaxBufferedAmount uint64
+	LowBufferedAmount uint64
+	// Max size in bytes of a message, larger ones are rejected with
+	// ErrMessageTooLarge. Zero means DefaultMaxMessageSize
+	MaxMessageSize uint
+	Reconnect *ReconnectPolicy // nil disables automatic reconnection
+	// Called with the errors occurring in background (signaling, ICE,
+	// data channels), as *ConnectError. It must not block.
+	OnError func(error)
+	// Local audio/video tracks, added before the offer
+	Tracks []webrtc.TrackLocal
+	// Called when the remote peer starts sending a track
+	OnTrack func(*webrtc.TrackRemote, *webrtc.RTPReceiver)
+	// Transport of the signaling messages.
+	// nil means a WebSocketSignaler to Signaling with Key
+	Signaler Signaler
+	Heartbeat *HeartbeatPolicy // nil disables the heartbeat
+	// Logger of the connection, also receiving the logs of pion.
+	// nil disables logging (pion errors still go to stderr)
+	Logger *slog.Logger
+	Network *NetworkSettings // ICE options, nil means the defaults of pion
+	// Local DTLS certificate, e.g. from LoadOrCreateCertificate, so that
+	// remote peers can pin its fingerprint. nil means a new one per connection
+	Certificate *webrtc.Certificate
+	// Fingerprints of the trusted remote certificates, see Fingerprint.
+	// If not empty, the connection fails with ErrUntrustedPeer when the
+	// remote description has other fingerprints
+	TrustedFingerprints []string
+	// pion API shared by many connections, see NewAPI.
+	// If set, its options replace Network and the routing of the pion logs
+	API *webrtc.API
 }
 
 // Interface to represent a two-way channel
@@ -26,10 +69,12 @@ type IOChannel interface {
 }
 
 type Connection struct {
-	// Signaling connection (ws)
-	sock *ws.Conn
+	// Signaling connection
+	signaler Signaler
 	// Peer connection (webrtc)
 	peer *webrtc.PeerConnection
+	// data channel bound to In and Out
+	dc *webrtc.DataChannel
 
 	// IO buffers
 	// connection output (receive from remote)
@@ -37,9 +82,6 @@ type Connection struct {
 	// connection input (send to remote)
 	In  chan []byte
 
-	// State channel
-	State chan webrtc.PeerConnectionState 
-
 	// settings
 	Settings *ConnectionSettings
 
@@ -49,6 +91,54 @@ type Connection struct {
 	// true iff CloseAll has been called
 	IsClosed bool
 
+	// closed when the data channel opens
+	opened chan struct{}
+	openOnce sync.Once
+	// first error returned by ConsumeSignaling
+	signalErr chan error
+
+	// named data channels, by label
+	channels map[string]*Channel
+	chmu sync.Mutex
+
+	// closed when ConsumeSignaling stops reading the current session
+	signalingDone chan struct{}
+	// closed by CloseAll
+	closed chan struct{}
+	// reason of the closure, see Err
+	err *ConnectError
+	// true while a reconnection is in progress
+	reconnecting bool
+	// closed and replaced at every peer connection state change
+	stateWake chan struct{}
+	// remote candidates received before the remote description
+	pendingCandidates []webrtc.ICECandidateInit
+	// true once an offer has been sent or received
+	negotiated bool
+	// true iff the last remote offer has been ignored because of glare
+	ignoreOffer bool
+	// true iff the remote peer asked for an offer not sent yet
+	offerRequested bool
+	// local candidates waiting to be signaled
+	outCandidates []*webrtc.ICECandidate
+	flushing bool
+	candmu sync.Mutex
+	// true once stop has been closed
+	closing bool
+	// closed by Close and CloseAll: In is not accepting messages anymore.
+	// In itself is never closed, so that senders cannot panic
+	stop chan struct{}
+	// guard of Out
+	out output
+	// closed when the send loop of the default data channel returns
+	sendDone chan struct{}
+	// logger with the key hash and the role
+	log atomic.Pointer[slog.Logger]
+	// keepalive state, see HeartbeatPolicy
+	hb heartbeat
+	// state subscribers
+	states *broadcaster[StateEvent]
+
 	mu sync.Mutex	
 }
 
@@ -74,180 +164,422 @@ func FromSettings(settings *ConnectionSettings) (*Connection, error) {
 	return Answer(c)
 }
 
+// Same as FromSettings, but honours ctx for the whole setup and returns only
+// once the data channel is open.
+// On failure or cancellation the connection is closed and the returned error
+// is a *ConnectError describing the phase which failed.
+func FromSettingsContext(ctx context.Context, settings *ConnectionSettings) (*Connection, error) {
+	if settings.BufferSize == 0 {
+		return nil, errors.New("Buffer size must be greater than 0")
+	}
+	c := CreateConnection(settings)
+	fail := func(phase Phase, err error) (*Connection, error) {
+		c.CloseAll()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return c, &ConnectError{Phase: phase, Err: err}
+	}
+
+	if err := c.ConnectSignalingContext(ctx); err != nil {
+		return fail(PhaseSignaling, err)
+	}
+
+	// tear down everything if ctx expires before the channel is open
+	stop := context.AfterFunc(ctx, func() { c.CloseAll() })
+	defer stop()
+
+	if err := c.MakePeerConnection(); err != nil {
+		return fail(PhasePeerConnection, err)
+	}
+
+	var err error
+	if c.Offer {
+		_, err = OfferContext(ctx, c)
+	} else {
+		_, err = AnswerContext(ctx, c)
+	}
+	if err != nil {
+		return fail(PhaseNegotiation, err)
+	}
+
+	if err := c.WaitOpen(ctx); err != nil {
+		var cerr *ConnectError
+		if errors.As(err, &cerr) {
+			return fail(cerr.Phase, cerr.Err)
+		}
+		return fail(PhaseDataChannel, err)
+	}
+	return c, nil
+}
+
 // Instantiates a new connection with given settings
 func CreateConnection(settings *ConnectionSettings) *Connection {
+	signaler := settings.Signaler
+	if signaler == nil {
+		signaler = NewWebSocketSignaler(settings.Signaling, settings.Key)
+	}
 	c := Connection {
-		sock: nil,
+		signaler: signaler,
 		peer: nil,
 		Out: make(chan []byte, settings.BufferSize),
 		In: make(chan []byte, settings.BufferSize),
-		State: make(chan webrtc.PeerConnectionState, 1),
+		states: newBroadcaster[StateEvent](),
+		sendDone: make(chan struct{}),
 		Settings: settings,
+		opened: make(chan struct{}),
+		signalErr: make(chan error, 1),
+		channels: make(map[string]*Channel),
+		closed: make(chan struct{}),
+		stop: make(chan struct{}),
+		stateWake: make(chan struct{}),
 	}
+	c.log.Store(settings.logger())
 	return &c
 }
 
-// Makes a ws connection with the given url and sends the key to it.
-// Connection process: ws connect -> (OFFER|ANSWER) -> Ready
+// Connects to the remote peer through the signaler, which decides the role.
+// With the default WebSocketSignaler:
+// ws connect -> (OFFER|ANSWER) -> Ready
 // Returns when the other peer has connected.
 func (c *Connection) ConnectSignaling() error {
-	url := c.Settings.Signaling + "/"
+	return c.ConnectSignalingContext(context.Background())
+}
 
-	conn, _, err := ws.DefaultDialer.Dial(url, nil)
+// Same as ConnectSignaling, but gives up when ctx is done.
+// In that case ctx.Err() is returned.
+func (c *Connection) ConnectSignalingContext(ctx context.Context) error {
+	offer, err := c.signaler.Connect(ctx)
 	if err != nil {
-		if conn != nil {
-			conn.Close()
-		}
 		return err
 	}
 
-	err = conn.WriteMessage(ws.TextMessage, []byte(c.Settings.Key))
-	if err != nil {
-		conn.Close()
-		return  err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.IsClosed {
+		c.signaler.Close()
+		return errors.New("Connection closed")
 	}
+	c.signalingDone = make(chan struct{})
+	c.Offer = offer
+	c.logRole(offer)
+	c.logger().Info("signaling connected")
+	return nil
+}
 
-	// ROLE
-	_, resp, err := conn.ReadMessage()
-	if err != nil {
-		conn.Close()
-		return err
+// Sends an ICE candidate to the signaling server,
+// nil meaning that gathering is complete
+func (c *Connection) signalCandidate(candidate *webrtc.ICECandidate) error {
+	if candidate == nil {
+		return c.signal(Message{Type: MessageEndOfCandidates})
 	}
+	init := candidate.ToJSON()
+	return c.signal(Message{Type: MessageCandidate, Candidate: &init})
+}
 
-	switch string(resp) {
-		case "OFFER": c.Offer=true
-		case "ANSWER": c.Offer=false
-		default: 
-			conn.Close()
-			return errors.New("Bad response: " + string(resp))
+// Queues a local candidate to be signaled.
+// pion can emit candidates from SetLocalDescription, while c.mu is held:
+// they are sent in order by a separate goroutine, after the description.
+func (c *Connection) queueCandidate(candidate *webrtc.ICECandidate) {
+	c.candmu.Lock()
+	defer c.candmu.Unlock()
+	c.outCandidates = append(c.outCandidates, candidate)
+	if !c.flushing {
+		c.flushing = true
+		go c.flushCandidates()
 	}
+}
 
-	// Ready
-	_, resp, err = conn.ReadMessage()
-	if err != nil {
-		conn.Close()
-		return err
-	}
-	if string(resp) != "Ready" {
-		conn.Close()
-		return errors.New("Bad response: " + string(resp))
+// Signals the queued candidates until the queue is empty
+func (c *Connection) flushCandidates() {
+	for {
+		c.candmu.Lock()
+		if len(c.outCandidates) == 0 {
+			c.flushing = false
+			c.candmu.Unlock()
+			return
+		}
+		candidate := c.outCandidates[0]
+		c.outCandidates = c.outCandidates[1:]
+		c.candmu.Unlock()
+
+		if err := c.signalCandidate(candidate); err != nil {
+			c.report(PhaseSignaling, err)
+		}
 	}
-	c.sock = conn
-	return nil
 }
 
-// Sends an ICEcandidate to the signaling server
-func (c *Connection) signalCandidate(candidate *webrtc.ICECandidate) error {
-	candidateJSON := []byte(candidate.ToJSON().Candidate)
+// Sends msg through the signaler, giving up once ctx is done.
+// c.mu must be held.
+func (c *Connection) writeMessage(ctx context.Context, msg Message) error {
+	return c.signaler.Send(ctx, msg)
+}
+
+// Same as writeMessage, without deadline, taking c.mu
+func (c *Connection) signal(msg Message) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.sock.WriteJSON(map[string][]byte{
-		"type": []byte("candidate"),
-		"ice":  candidateJSON,
-	})
+	return c.writeMessage(context.Background(), msg)
+}
+
+// Collects the STUN, TURN and additional ICE servers of the settings
+func (s *ConnectionSettings) iceServers() []webrtc.ICEServer {
+	servers := []webrtc.ICEServer{}
+	if len(s.STUN) > 0 {
+		servers = append(servers, webrtc.ICEServer{URLs: s.STUN})
+	}
+	if s.TURN != "" {
+		servers = append(servers, webrtc.ICEServer{
+			URLs: []string{s.TURN},
+			Username: s.TURNUsername,
+			Credential: s.TURNCredential,
+		})
+	}
+	return append(servers, s.ICEServers...)
+}
+
+// Builds a pion API with the Network options of settings, and its Logger
+func NewAPI(settings *ConnectionSettings) (*webrtc.API, error) {
+	return newAPI(settings, settings.logger())
+}
+
+// Same as NewAPI, routing the pion logs to logger
+func newAPI(settings *ConnectionSettings, logger *slog.Logger) (*webrtc.API, error) {
+	se := webrtc.SettingEngine{}
+	if settings.Logger != nil {
+		se.LoggerFactory = NewLoggerFactory(logger)
+	}
+	if settings.Network != nil {
+		if err := settings.Network.apply(&se); err != nil {
+			return nil, err
+		}
+	}
+	return webrtc.NewAPI(webrtc.WithSettingEngine(se)), nil
 }
 
 func (c *Connection) MakePeerConnection() error {
 	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: c.Settings.STUN},
-		},
+		ICEServers: c.Settings.iceServers(),
+		ICETransportPolicy: c.Settings.ICETransportPolicy,
+	}
+	if c.Settings.Certificate != nil {
+		config.Certificates = []webrtc.Certificate{*c.Settings.Certificate}
 	}
 
-	peer_conn, err := webrtc.NewPeerConnection(config)
+	api := c.Settings.API
+	if api == nil {
+		var err error
+		if api, err = newAPI(c.Settings, c.logger()); err != nil {
+			return err
+		}
+	}
+	peer_conn, err := api.NewPeerConnection(config)
 	if err != nil {
 		return err
 	}
 	c.peer = peer_conn
 
 	peer_conn.OnICECandidate(func(candidate *webrtc.ICECandidate) {
-		if candidate != nil {
-			// Send the ICE candidate to the signaling server
-			if err := c.signalCandidate(candidate); err != nil {
+		// Send the ICE candidate to the signaling server
+		c.queueCandidate(candidate)
+	})
+
+	peer_conn.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		c.wakeState()
+		c.publish(StateEvent{Kind: StatePeerConnection, PeerConnection: state})
+		switch state {
+		case webrtc.PeerConnectionStateDisconnected:
+			c.startReconnect()
+		case webrtc.PeerConnectionStateFailed:
+			if !c.startReconnect() {
+				// not recovered, as when reconnection gives up
+				c.fail(PhaseNegotiation, ErrPeerFailed)
 			}
 		}
 	})
 
-	peer_conn.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		c.State <- state
+	peer_conn.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		c.publish(StateEvent{Kind: StateICE, ICE: state})
 	})
 
+	peer_conn.OnSignalingStateChange(func(state webrtc.SignalingState) {
+		c.publish(StateEvent{Kind: StateSignaling, Signaling: state})
+	})
+
+	peer_conn.OnDataChannel(c.onDataChannel)
+
+	peer_conn.OnNegotiationNeeded(func() {
+		go c.renegotiate()
+	})
+
+	if c.Settings.OnTrack != nil {
+		peer_conn.OnTrack(c.Settings.OnTrack)
+	}
+	for _, track := range c.Settings.Tracks {
+		if _, err := c.AddTrack(track); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // Consumes the signaling messages. This function is safe to be runned asynchronously
-// Expected types:
+// Expected types (see Message):
 //  offer: an SDP offer
 //  answer: an SDP answer
 //  candidate: ICE candidate message
+//  end-of-candidates: no more candidates will follow
+//  negotiate: request for an offer
+//  error: error of the remote peer
 func (c *Connection) ConsumeSignaling() error {
-	var message map[string][]byte
-	var sdp webrtc.SessionDescription
-
 	for {
-		if err := c.sock.ReadJSON(&message); err != nil {
+		msg, err := c.signaler.Recv()
+		if errors.Is(err, ErrUnknownMessage) {
+			// sent by a newer peer
+			c.report(PhaseSignaling, errors.New("Ignored signaling message of type "+string(msg.Type)))
+			continue
+		}
+		if err == nil {
+			err = c.handleMessage(msg)
+		}
+		if err != nil {
+			// let the remote peer know why signaling stops
+			c.signal(Message{Type: MessageError, Error: err.Error()})
 			return err
 		}
-		switch string(message["type"]) {
-		case "offer":
-			// 1. Set the offer as RemoteDescription
-			if err := json.Unmarshal(message["sdp"], &sdp); err != nil {
-				return err
-			}
+	}
+}
 
-			if err := c.peer.SetRemoteDescription(sdp); err != nil {
-				return err
-			}
+// Handles a valid signaling message
+func (c *Connection) handleMessage(msg Message) error {
+	switch msg.Type {
+	case MessageOffer:
+		ignore, err := c.acceptOffer()
+		if err != nil || ignore {
+			return err
+		}
 
-			// 2. Create an SDP answer
-			answer, err := c.peer.CreateAnswer(nil)
-			if err != nil {
-				return err
-			}
+		// 1. Set the offer as RemoteDescription
+		if err := c.setRemoteDescription(*msg.SDP); err != nil {
+			return err
+		}
 
-			// 3. Set the local description with the answer
-			if err := c.peer.SetLocalDescription(answer); err != nil {
-				return err
-			}
+		// 2. Create, set and send the SDP answer
+		return c.sendAnswer()
+	case MessageAnswer:
+		if err := c.setRemoteDescription(*msg.SDP); err != nil {
+			return err
+		}
+		c.offerIfRequested()
+	case MessageNegotiate:
+		return c.requestedOffer(msg.Kinds)
+	case MessageCandidate:
+		return c.addCandidate(*msg.Candidate)
+	case MessageEndOfCandidates:
+		return c.addCandidate(webrtc.ICECandidateInit{})
+	case MessageError:
+		c.report(PhaseSignaling, errors.New("Remote error: "+msg.Error))
+	}
+	return nil
+}
 
-			// 4. Send the SDP answer to the signaling server
-			answerJSON, err := json.Marshal(answer)
-			if err != nil {
-				return err
-			}
-			c.mu.Lock()
-			err = c.sock.WriteJSON(map[string][]byte{
-				"type": []byte("answer"),
-				"sdp":  answerJSON,
-			})
-			c.mu.Unlock()
-			if err != nil {
-				return err
-			}
-		case "answer":
-			// 1. Set the offer as RemoteDescription
-			if err := json.Unmarshal(message["sdp"], &sdp); err != nil {
-				return err
-			}
+// Adds a remote ICE candidate. Candidates can overtake the
+// offer/answer they belong to: they are then queued until
+// the remote description is set.
+func (c *Connection) addCandidate(candidate webrtc.ICECandidateInit) error {
+	c.mu.Lock()
+	if c.peer.RemoteDescription() == nil {
+		c.pendingCandidates = append(c.pendingCandidates, candidate)
+		c.mu.Unlock()
+		return nil
+	}
+	ignore := c.ignoreOffer
+	c.mu.Unlock()
+	if err := c.peer.AddICECandidate(candidate); err != nil && !ignore {
+		return err
+	}
+	return nil
+}
 
-			if err := c.peer.SetRemoteDescription(sdp); err != nil {
-				return err
-			}
-		case "candidate":
-			if err := c.peer.AddICECandidate(
-				webrtc.ICECandidateInit{Candidate: string(message["ice"])},
-			); err != nil {
-				return err
-			}
+// Sets the remote description and adds the queued candidates
+func (c *Connection) setRemoteDescription(sdp webrtc.SessionDescription) error {
+	if err := c.Settings.verifyFingerprints(sdp); err != nil {
+		return err
+	}
+	if err := c.peer.SetRemoteDescription(sdp); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	pending := c.pendingCandidates
+	c.pendingCandidates = nil
+	c.mu.Unlock()
+	for _, candidate := range pending {
+		if err := c.peer.AddICECandidate(candidate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs ConsumeSignaling, keeping its error for WaitOpen
+func (c *Connection) consume() {
+	c.mu.Lock()
+	done := c.signalingDone
+	c.mu.Unlock()
+	defer close(done)
+	if err := c.ConsumeSignaling(); err != nil {
+		if errors.Is(err, ErrUntrustedPeer) {
+			// unlike the loss of the signaling session, never recovered
+			c.fail(PhaseNegotiation, err)
+		}
+		c.mu.Lock()
+		closed := c.IsClosed
+		c.mu.Unlock()
+		if closed {
+			// caused by CloseAll, whose reason is kept by Err
+			return
+		}
+		c.report(PhaseSignaling, err)
+		select {
+		case c.signalErr <- err:
+		default:
+		}
+	}
+}
+
+// Blocks until the data channel is open.
+// Returns a *ConnectError if signaling stops or the connection is
+// closed before that (with the reason returned by Err, if any),
+// or if ctx is done first.
+func (c *Connection) WaitOpen(ctx context.Context) error {
+	select {
+	case <-c.opened:
+		return nil
+	case err := <-c.signalErr:
+		return &ConnectError{Phase: PhaseNegotiation, Err: err}
+	case <-c.closed:
+		select {
+		case <-c.opened:
+			// closed after opening
+			return nil
 		default:
 		}
+		if err := c.Err(); err != nil {
+			return err
+		}
+		return &ConnectError{Phase: PhaseDataChannel, Err: net.ErrClosed}
+	case <-ctx.Done():
+		return &ConnectError{Phase: PhaseDataChannel, Err: ctx.Err()}
 	}
 }
 
 func (c *Connection) CreateDataChannel() (*webrtc.DataChannel, error) {
-	return c.peer.CreateDataChannel("data", nil)
+	return c.peer.CreateDataChannel(DefaultLabel, nil)
 }
 
+// Closes the connection immediately, dropping the pending messages.
+// See Close for a graceful close.
 func (c *Connection) CloseAll() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -255,103 +587,218 @@ func (c *Connection) CloseAll() error {
 	if c.IsClosed == true {
 		return nil
 	}
+	// set first: the buffers are closed even if a step below fails
+	c.IsClosed = true
 
-	close(c.In)
-	close(c.Out)
-	if c.sock != nil {
-		if err := c.sock.Close(); err != nil {
-			return err
-		}
+	if !c.closing {
+		c.closing = true
+		close(c.stop)
+	}
+	close(c.closed)
+	// after closed, which stops the delivery in progress
+	c.out.close(c.Out)
+	c.closeSubscribers()
+	c.chmu.Lock()
+	for _, ch := range c.channels {
+		ch.Close()
 	}
+	c.chmu.Unlock()
+	errs := []error{c.signaler.Close()}
 	if c.peer != nil {
-		if err := c.peer.Close(); err != nil {
-			return err
-		}
+		errs = append(errs, c.peer.Close())
 	}
 
-	c.IsClosed = true
-	return nil
+	if c.err != nil {
+		c.logger().Error("connection closed", "phase", c.err.Phase.String(), "error", c.err.Err)
+	} else {
+		c.logger().Info("connection closed")
+	}
+	return errors.Join(errs...)
 }
 
 // Connect In and Out channels to the peer connection
 // Without calling this function, those channels are detached
 // and will not send data
 func (c *Connection) AttachFunctionality(dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	c.dc = dc
+	c.mu.Unlock()
+	c.watchDataChannel(dc, nil)
 	dc.OnOpen(func() {
+		c.openOnce.Do(func() { close(c.opened) })
+		c.publish(StateEvent{Kind: StateDataChannel, DataChannel: webrtc.DataChannelStateOpen, Label: dc.Label()})
+		if c.Settings.Heartbeat != nil {
+			go c.heartbeat(dc, c.Settings.Heartbeat)
+		}
 		// send
-		for msg := range c.In {
-			if err := dc.Send(msg); err != nil {
-				c.CloseAll()
-				return
-			}
+		defer close(c.sendDone)
+		if err := sendLoop(dc, c.In, c.sendOptions(c.closed, c.stop)); err != nil {
+			c.fail(PhaseDataChannel, err)
 		}
 	})
 
+	r := reassembler{max: c.Settings.maxMessageSize()}
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if len(msg.Data) > 0 {
+			switch msg.Data[0] {
+			case frameClose:
+				// the remote peer has closed, after sending everything
+				go c.CloseAll()
+				return
+			case framePing:
+				// answered even if the local heartbeat is disabled
+				dc.Send(append([]byte{framePong}, msg.Data[1:]...))
+				return
+			case framePong:
+				c.pong(msg.Data[1:])
+				return
+			}
+		}
 		//receive
-		c.Out <- msg.Data
+		data, ok, err := r.push(msg.Data)
+		if err != nil {
+			c.report(PhaseDataChannel, err)
+		}
+		if ok {
+			c.out.deliver(c.Out, c.closed, data)
+		}
 	})
 }
 
-// Answer to a sdp offer.
+// Answer to a sdp offer. The data channels opened by the offerer
+// are attached by the handler set in MakePeerConnection.
 // Spawns a Connection.ConsumeSignaling process and returns
 // the newly created Connection object
 func Answer(connection *Connection) (*Connection, error) {
-	connection.peer.OnDataChannel(func(dc *webrtc.DataChannel) {
-		connection.AttachFunctionality(dc)
-	})
-	go connection.ConsumeSignaling()
+	return AnswerContext(context.Background(), connection)
+}
+
+// Same as Answer, fails if ctx is already done
+func AnswerContext(ctx context.Context, connection *Connection) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
+		connection.CloseAll()
+		return connection, err
+	}
+	go connection.consume()
 	return connection, nil
 }
 
 // Makes an RTC offer. 
 // Spawns a Connection.ConsumeSignaling process
 func Offer(connection *Connection) (*Connection, error) {
-	defer connection.mu.Unlock()
-	connection.mu.Lock()
+	return OfferContext(context.Background(), connection)
+}
 
-	dc, err := connection.CreateDataChannel()
-	if err != nil {
+// Same as Offer, but stops if ctx is done before the offer has been sent.
+// The ctx deadline, if any, bounds the write to the signaling server.
+func OfferContext(ctx context.Context, connection *Connection) (*Connection, error) {
+	if err := ctx.Err(); err != nil {
 		connection.CloseAll()
 		return connection, err
 	}
-	connection.AttachFunctionality(dc)
 
-	offer, err := connection.peer.CreateOffer(nil)
+	dc, err := connection.CreateDataChannel()
 	if err != nil {
 		connection.CloseAll()
 		return connection, err
 	}
+	connection.AttachFunctionality(dc)
 
-	if err = connection.peer.SetLocalDescription(offer); err != nil {
+	if err := connection.sendOffer(ctx, nil); err != nil {
 		connection.CloseAll()
 		return connection, err
 	}
 
-	offerJSON, err := json.Marshal(offer)
+	go connection.consume()
+	return connection, nil
+}
+
+// Creates an offer, sets it as local description and sends it.
+// The lock is held until the offer is sent, so that no candidate
+// is signaled before it.
+func (c *Connection) sendOffer(ctx context.Context, options *webrtc.OfferOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a negotiation is in progress: once it completes pion
+	// checks again whether a new one is needed
+	if c.peer.SignalingState() != webrtc.SignalingStateStable {
+		return nil
+	}
+
+	offer, err := c.peer.CreateOffer(options)
 	if err != nil {
-		connection.CloseAll()
-		return connection, err
+		return err
 	}
 
-	connection.sock.WriteJSON(map[string][]byte{
-		"type": []byte("offer"),
-		"sdp":  offerJSON,
-	})
+	if err = c.peer.SetLocalDescription(offer); err != nil {
+		return err
+	}
 
+	err = c.writeMessage(ctx, Message{Type: MessageOffer, SDP: &offer})
+	if err == nil {
+		c.negotiated = true
+		c.offerRequested = false
+	}
+	return err
+}
 
-	go connection.ConsumeSignaling()
-	return connection, nil
+// Creates an answer, sets it as local description and sends it.
+// As in sendOffer, the lock is held until the answer is sent, so that
+// no candidate is signaled before it.
+func (c *Connection) sendAnswer() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	answer, err := c.peer.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := c.peer.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	return c.writeMessage(context.Background(), Message{Type: MessageAnswer, SDP: &answer})
 }
 
+// Sends b, dropping it if the connection is closed.
+// Too large messages are reported to Settings.OnError
 func (c *Connection) Send(b []byte) {
-	c.In <- b
+	if err := c.SendContext(context.Background(), b); errors.Is(err, ErrMessageTooLarge) {
+		c.report(PhaseDataChannel, err)
+	}
 }
 
 func (c *Connection) Recv() []byte {
 	return <- c.Out
 }
 
+// Same as Send, but returns net.ErrClosed if the connection is closed
+// (or being closed by Close), ErrMessageTooLarge if b exceeds
+// Settings.MaxMessageSize and ctx.Err() if ctx is done first
+func (c *Connection) SendContext(ctx context.Context, b []byte) error {
+	if len(b) > c.Settings.maxMessageSize() {
+		return ErrMessageTooLarge
+	}
+	return sendContext(ctx, c.In, c.stop, b)
+}
+
+// Same as Recv, but returns io.EOF (or the failure reason, see Err)
+// once the connection is closed, and ctx.Err() if ctx is done first
+func (c *Connection) RecvContext(ctx context.Context) ([]byte, error) {
+	select {
+	case msg, ok := <-c.Out:
+		if !ok {
+			if err := c.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (c *Connection) mutexSend(b []byte) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -1,17 +1,19 @@
 package connection
 
 import (
+	"context"
+	"errors"
 	"log"
 	"testing"
 	"slices"
+	"time"
 )
 
 
 func Test(t *testing.T) {
-	const port = "8080"
 	settings := ConnectionSettings{
-		Signaling:"ws://0.0.0.0:"+port,
-		STUN:[]string{"stun:stun.l.google.com:19302"},
+		Signaling:signalingURL,
+		Network:labNetwork(),
 		Key:"cd",
 		BufferSize:1,
 	}
@@ -50,3 +52,75 @@ func Test(t *testing.T) {
 	conn2.In <- payload
 }
 
+
+func TestFromSettingsContext(t *testing.T) {
+	settings := ConnectionSettings{
+		Signaling:signalingURL,
+		Key:"ctx",
+		BufferSize:1,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	payload := []byte("test")
+	done := make(chan bool, 1)
+
+	go func() {
+		defer func() { done <- true }()
+		conn1, err := FromSettingsContext(ctx, &settings)
+		if err != nil {
+			t.Errorf("Error while opening conn1: %v", err)
+			return
+		}
+		defer conn1.CloseAll()
+		conn1.Send(payload)
+		<-done
+	}()
+
+	conn2, err := FromSettingsContext(ctx, &settings)
+	if err != nil {
+		t.Fatalf("Error while opening conn2: %v", err)
+	}
+	defer conn2.CloseAll()
+	info := conn2.Recv()
+	if !slices.Equal(info, payload) {
+		t.Errorf("Expected %s, got %s", payload, info)
+	}
+	done <- true
+}
+
+func TestFromSettingsContextTimeout(t *testing.T) {
+	settings := ConnectionSettings{
+		Signaling:signalingURL,
+		Key:"nobody",
+		BufferSize:1,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// no peer will ever join
+	c, err := FromSettingsContext(ctx, &settings)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline error, got %v", err)
+	}
+	var cerr *ConnectError
+	if !errors.As(err, &cerr) || cerr.Phase != PhaseSignaling {
+		t.Errorf("Expected a signaling phase error, got %v", err)
+	}
+	if !c.IsClosed {
+		t.Errorf("Connection should be closed")
+	}
+}
+
+func TestEarlyCandidates(t *testing.T) {
+	// the signaling server delivers candidates before offers and answers
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "reorder"})
+	payload := []byte("reordered")
+	offerer.Send(payload)
+	if info := answerer.Recv(); !slices.Equal(info, payload) {
+		t.Errorf("Expected %s, got %s", payload, info)
+	}
+}
@@ -1,8 +1,11 @@
 package connection
 
 import (
+	"context"
+	"io"
+	"net"
 	"slices"
-	"fmt"
+	"sync"
 )
 
 // Utility for multiplexing over peer channel
@@ -11,7 +14,14 @@ type Dispatcher struct {
 	Id byte
 	Connection IOChannel
 	Out chan []byte
+	// set by Close, under mu
 	Closed bool
+
+	// guard of Out
+	out output
+	// closed by Close
+	closed chan struct{}
+	mu sync.Mutex
 }
 
 const ZeroByte = byte(0)
@@ -20,10 +30,10 @@ const OneByte = byte(1)
 //Make a new dispatcher with a certain id and cc as close channel 
 func NewDispatcher(id byte, conn IOChannel) *Dispatcher {
 	return &Dispatcher {
-		id,
-		conn,
-		make(chan []byte,1),
-		false,
+		Id: id,
+		Connection: conn,
+		Out: make(chan []byte,1),
+		closed: make(chan struct{}),
 	}
 }
 
@@ -67,9 +77,9 @@ func DualDispatch(
 
 					switch msg[0] {
 					case ZeroByte:
-						dispatcher0.Out <- toSend
+						dispatcher0.deliver(toSend)
 					case OneByte:
-						dispatcher1.Out <- toSend
+						dispatcher1.deliver(toSend)
 					default:
 						return
 					}
@@ -80,9 +90,19 @@ func DualDispatch(
 	return dispatcher0, dispatcher1
 }
 
-// Send b in the connection channel.
+// Sends b to Out, dropping it if the dispatcher is closed
+func (d *Dispatcher) deliver(b []byte) {
+	d.out.deliver(d.Out, d.closed, b)
+}
+
+// Send b in the connection channel, dropping it once the dispatcher is closed.
 // ID is added at the beginnning of b
 func (d *Dispatcher) Send(b []byte) {
+	select {
+	case <-d.closed:
+		return
+	default:
+	}
 	d.Connection.Send(slices.Concat([]byte{d.Id}, b))
 }
 
@@ -92,13 +112,40 @@ func (d *Dispatcher) Recv() []byte {
 	return <-d.Out
 }
 
+// Same as Send, with the errors of the connection.
+// Returns net.ErrClosed once the dispatcher is closed
+func (d *Dispatcher) SendContext(ctx context.Context, b []byte) error {
+	select {
+	case <-d.closed:
+		return net.ErrClosed
+	default:
+	}
+	return AdaptIOChannel(d.Connection).SendContext(ctx, slices.Concat([]byte{d.Id}, b))
+}
+
+// Same as Recv, but returns io.EOF once the dispatcher is closed
+func (d *Dispatcher) RecvContext(ctx context.Context) ([]byte, error) {
+	select {
+	case msg, ok := <-d.Out:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // Close a dispatcher. Set closed to true and
 // close Out channel. CloseChannel is left open.
 // Subsequent calls will have no effects.
-func (d *Dispatcher) Close() {
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if !d.Closed {
-		fmt.Println("closing")
 		d.Closed = true
-		close(d.Out)
+		close(d.closed)
+		d.out.close(d.Out)
 	}
+	return nil
 }
@@ -1,19 +1,34 @@
 package connection
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
 	"slices"
 	"testing"
+	"time"
 )
 
+// Stops the dispatchers of DualDispatch and waits for them to be closed.
+// Until then the dispatching goroutine may still read Out, and consume
+// a message meant for the connection itself.
+func stopDispatchers(cc chan bool, d *Dispatcher) {
+	cc <- true
+	for range d.Out {}
+}
+
 func TestDispatcher(t *testing.T) {
 	settings := &ConnectionSettings{
-		Signaling:"ws://0.0.0.0:8080",
-		STUN:[]string{"stun:stun.l.google.com:19302"},
+		Signaling:signalingURL,
+		Network:labNetwork(),
 		Key:"cd",
 		BufferSize:1,
 	}
 	
 	sync := make(chan bool, 1)
+	// both sides send to the connection once their dispatchers have stopped
+	closed := make(chan bool, 1)
 
 	p1 := []byte("A")
 	p2 := []byte("B")
@@ -35,7 +50,8 @@ func TestDispatcher(t *testing.T) {
 		if !slices.Equal(r1,p1) {
 			t.Errorf("Dispatcher 1B received %v instead of %v", r2, p2)
 		}
-		cc <- true
+		stopDispatchers(cc, d1)
+		closed <- true
 
 		r1 = c1.Recv()
 		if !slices.Equal(r1,p1) {
@@ -63,7 +79,8 @@ func TestDispatcher(t *testing.T) {
 	if !slices.Equal(r2,p2) {
 		t.Errorf("Dispatcher 2A received %v instead of %v", r2, p2)
 	}
-	cc <- true
+	stopDispatchers(cc, d1)
+	<-closed
 	c2.Send(p1)	
 
 	r1 = c2.Recv()
@@ -73,3 +90,24 @@ func TestDispatcher(t *testing.T) {
 
 	<-sync
 }
+
+func TestDispatcherClose(t *testing.T) {
+	c1, c2 := NewDummyConnection(), NewDummyConnection()
+	c1.Connect(c2)
+	d := NewDispatcher(ZeroByte, c1)
+	d.Close()
+	d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.SendContext(ctx, []byte("closed")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+	d.Send([]byte("closed"))
+	if msg, err := c2.RecvContext(ctx); err == nil {
+		t.Errorf("Closed dispatcher sent %q", msg)
+	}
+	if _, err := d.RecvContext(context.Background()); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
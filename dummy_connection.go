@@ -1,14 +1,24 @@
 package connection
 
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
 type DummyConnection struct {
 	Out chan []byte
 	Peer *DummyConnection
+	// closed by Close
+	closed chan struct{}
+	closeOnce sync.Once
 }
 
 func NewDummyConnection() *DummyConnection {
 	return &DummyConnection{
-		make(chan []byte, 1),
-		nil,
+		Out: make(chan []byte, 1),
+		closed: make(chan struct{}),
 	}
 }
 
@@ -25,3 +35,47 @@ func (c *DummyConnection) Send(b []byte) {
 func (c *DummyConnection) Recv() []byte {
 	return <- c.Out
 }
+
+// Same as Send, but returns net.ErrClosed if either side is closed
+func (c *DummyConnection) SendContext(ctx context.Context, b []byte) error {
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	case <-c.Peer.closed:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case c.Peer.Out <- b:
+		return nil
+	case <-c.Peer.closed:
+		return net.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Same as Recv, but returns io.EOF once either side is closed
+// and no message is pending
+func (c *DummyConnection) RecvContext(ctx context.Context) ([]byte, error) {
+	select {
+	case msg := <-c.Out:
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-c.Out:
+		return msg, nil
+	case <-c.closed:
+		return nil, io.EOF
+	case <-c.Peer.closed:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *DummyConnection) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
@@ -0,0 +1,96 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Step of the connection setup in which an error occurred
+type Phase int
+
+const (
+	PhaseSignaling      Phase = iota // connecting to the signaling server
+	PhasePeerConnection              // creating the webrtc peer connection
+	PhaseNegotiation                 // offer/answer and ICE exchange
+	PhaseDataChannel                 // waiting for the data channel to open
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseSignaling:
+		return "signaling"
+	case PhasePeerConnection:
+		return "peer connection"
+	case PhaseNegotiation:
+		return "negotiation"
+	case PhaseDataChannel:
+		return "data channel"
+	default:
+		return fmt.Sprintf("Phase(%d)", int(p))
+	}
+}
+
+// Error returned by the context-aware setup functions.
+// Err is the underlying cause, e.g. context.DeadlineExceeded
+type ConnectError struct {
+	Phase Phase
+	Err   error
+}
+
+func (e *ConnectError) Error() string {
+	return e.Phase.String() + ": " + e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// Reported when the peer connection fails and is not recovered
+	ErrPeerFailed = errors.New("Peer connection failed")
+	// Reason of the closure when all the reconnection attempts failed
+	ErrReconnectFailed = errors.New("Reconnection failed")
+	// Reason of the closure when the peer stops answering the heartbeat
+	ErrPeerUnresponsive = errors.New("Peer unresponsive")
+	// Reason of the closure when the remote certificate is not pinned,
+	// see ConnectionSettings.TrustedFingerprints
+	ErrUntrustedPeer = errors.New("Untrusted peer certificate")
+)
+
+// Reports an error occurred in background to Settings.OnError
+func (c *Connection) report(phase Phase, err error) {
+	c.logger().Warn("background error", "phase", phase.String(), "error", err)
+	if c.Settings.OnError != nil {
+		c.Settings.OnError(&ConnectError{Phase: phase, Err: err})
+	}
+}
+
+// Reports err and closes the connection because of it.
+// The error is then returned by Err.
+func (c *Connection) fail(phase Phase, err error) {
+	c.mu.Lock()
+	if c.IsClosed {
+		c.mu.Unlock()
+		return
+	}
+	c.err = &ConnectError{Phase: phase, Err: err}
+	c.mu.Unlock()
+	c.report(phase, err)
+	c.CloseAll()
+}
+
+// Returns the error which caused the connection to close,
+// nil if the connection is open or has been closed by CloseAll
+func (c *Connection) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		return nil
+	}
+	return c.err
+}
+
+// Returns a channel closed when the connection is closed
+func (c *Connection) Done() <-chan struct{} {
+	return c.closed
+}
@@ -0,0 +1,152 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReportSignalingError(t *testing.T) {
+	errs := make(chan error, 4)
+	offerer, answerer := connectPair(t, ConnectionSettings{
+		Key: "errors",
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+
+	// the signaling session is lost, the peers stay connected
+	answerer.signaler.Close()
+	select {
+	case err := <-errs:
+		var cerr *ConnectError
+		if !errors.As(err, &cerr) || cerr.Phase != PhaseSignaling {
+			t.Errorf("Expected a signaling error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Signaling error not reported")
+	}
+	if offerer.Err() != nil || answerer.Err() != nil {
+		t.Errorf("Connections should not be failed")
+	}
+}
+
+func TestErrDone(t *testing.T) {
+	c := CreateConnection(&ConnectionSettings{BufferSize: 1})
+	cause := errors.New("boom")
+	select {
+	case <-c.Done():
+		t.Fatalf("Connection should be open")
+	default:
+	}
+
+	c.fail(PhaseDataChannel, cause)
+	select {
+	case <-c.Done():
+	default:
+		t.Fatalf("Connection should be closed")
+	}
+	if !errors.Is(c.Err(), cause) {
+		t.Errorf("Expected %v, got %v", cause, c.Err())
+	}
+
+	c = CreateConnection(&ConnectionSettings{BufferSize: 1})
+	c.CloseAll()
+	if c.Err() != nil {
+		t.Errorf("Expected no error after CloseAll, got %v", c.Err())
+	}
+}
+
+// Signaler failing to close
+type brokenSignaler struct {
+	Signaler
+}
+
+func (s brokenSignaler) Close() error {
+	s.Signaler.Close()
+	return errors.New("cannot close")
+}
+
+func TestCloseAllError(t *testing.T) {
+	s, _ := NewMemorySignalerPair()
+	c := CreateConnection(&ConnectionSettings{BufferSize: 1, Signaler: brokenSignaler{s}})
+	if err := c.CloseAll(); err == nil {
+		t.Errorf("Expected the error of the signaler")
+	}
+	if !c.IsClosed {
+		t.Errorf("Connection should be closed")
+	}
+	// closing again must not close the buffers twice
+	if err := c.CloseAll(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	c.fail(PhaseSignaling, errors.New("late"))
+}
+
+// Network settings failing the peer connection within a second
+func failFastNetwork() *NetworkSettings {
+	network := labNetwork()
+	network.DisconnectedTimeout = 200 * time.Millisecond
+	network.FailedTimeout = 500 * time.Millisecond
+	network.KeepAliveInterval = 50 * time.Millisecond
+	return network
+}
+
+// Makes c disappear without telling its peer: the signaling session and
+// the ICE transport are stopped, the DTLS session is not closed
+func vanish(c *Connection) {
+	c.signaler.Close()
+	c.peer.SCTP().Transport().ICETransport().Stop()
+}
+
+func TestPeerFailed(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "peer-failed", Network: failFastNetwork()})
+
+	vanish(answerer)
+	select {
+	case <-offerer.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Connection not closed")
+	}
+	if !errors.Is(offerer.Err(), ErrPeerFailed) {
+		t.Errorf("Expected ErrPeerFailed, got %v", offerer.Err())
+	}
+	if _, err := offerer.RecvContext(context.Background()); !errors.Is(err, ErrPeerFailed) {
+		t.Errorf("Expected ErrPeerFailed from RecvContext, got %v", err)
+	}
+}
+
+func TestPeerFailedBeforeOpen(t *testing.T) {
+	apis, down := lossyNetwork(t)
+	down.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res := make(chan error, 2)
+	for _, api := range apis {
+		go func() {
+			_, err := FromSettingsContext(ctx, &ConnectionSettings{
+				Signaling: signalingURL, Key: "failed-before-open", BufferSize: 1, API: api,
+			})
+			res <- err
+		}()
+	}
+	// the peer failing last may see the signaling session end first
+	failed := 0
+	for range apis {
+		err := <-res
+		var cerr *ConnectError
+		if errors.Is(err, ErrPeerFailed) && errors.As(err, &cerr) && cerr.Phase == PhaseNegotiation {
+			failed++
+		} else {
+			t.Logf("Connection error: %v", err)
+		}
+	}
+	if failed == 0 {
+		t.Errorf("Expected ErrPeerFailed in the negotiation phase")
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 
-	"github.com/pion/webrtc/v4"
 	"github.com/leogem2003/directchan"
 )
 
@@ -25,16 +26,16 @@ func chat(c *connection.Connection) {
 	}()
 
 	// state daemon
+	states, _ := c.Subscribe(16)
 	go func() {
-		for {
-			state := <-c.State
-			fmt.Printf("State changed: %v\n", state)
-			switch state {
-			case webrtc.PeerConnectionStateDisconnected:
-				fmt.Printf("closing...")
-				exit <- true
+		for ev := range states {
+			if ev.Kind == connection.StatePeerConnection {
+				fmt.Printf("State changed: %v\n", ev.PeerConnection)
 			}
 		}
+		// closed after the final closed state
+		fmt.Printf("closing...")
+		exit <- true
 	}()
 
 	var msg string
@@ -45,19 +46,84 @@ func chat(c *connection.Connection) {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Missing argument. Usage: example <ws address> key")
-		return
+	manual := flag.Bool("manual", false, "pair by copying the signaling blobs by hand, without server")
+	offer := flag.Bool("offer", false, "with -manual, make the offer (exactly one peer must set it)")
+	role := flag.String("role", "", "listen or dial, instead of pairing by arrival order")
+	configPath := flag.String("config", "", "JSON or TOML configuration file, see connection.Config")
+	cert := flag.String("cert", "", "PEM file of the local certificate, created if missing")
+	trust := flag.String("trust", "", "fingerprint of the remote certificate, as printed with -cert")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: example [-config file] <ws address> key")
+		fmt.Fprintln(os.Stderr, "       example [-config file] -manual [-offer]")
+		flag.PrintDefaults()
 	}
-	var err error
+	flag.Parse()
+
 	var conn *connection.Connection
-	settings := new(connection.ConnectionSettings)
-	settings.Key = os.Args[2]
-	settings.STUN = []string{"stun:stun.l.google.com:19302"}
-	settings.Signaling = os.Args[1]
-	settings.BufferSize = 1
+	config, err := connection.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// the command line overrides the configuration
+	if !*manual && flag.NArg() >= 2 {
+		config.Signaling = flag.Arg(0)
+		config.Key = flag.Arg(1)
+	}
+	if *cert != "" {
+		config.Certificate = *cert
+	}
+	if *trust != "" {
+		config.TrustedFingerprints = []string{*trust}
+	}
+	settings, err := config.Settings()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if settings.Certificate != nil {
+		fingerprint, err := connection.Fingerprint(settings.Certificate)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Fprintf(os.Stderr, "Local fingerprint: %q\n", fingerprint)
+	}
+
+	if *manual {
+		if *offer {
+			fmt.Fprintln(os.Stderr, "Copy the line below to the other peer, then paste its answer:")
+		} else {
+			fmt.Fprintln(os.Stderr, "Paste the offer of the other peer, then copy the line printed back to it:")
+		}
+		settings.Signaler = connection.NewManualSignaler(*offer, os.Stdin, os.Stdout)
+		// chat only once the blobs have been exchanged
+		conn, err = connection.FromSettingsContext(context.Background(), settings)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		chat(conn)
+		return
+	}
 
-	conn, err = connection.FromSettings(settings)
+	if settings.Signaling == "" {
+		flag.Usage()
+		return
+	}
+
+	switch *role {
+	case "":
+		conn, err = connection.FromSettings(settings)
+	case "dial":
+		conn, err = connection.Dial(context.Background(), settings)
+	case "listen":
+		var l *connection.Listener
+		if l, err = connection.Listen(settings); err == nil {
+			fmt.Fprintln(os.Stderr, "Waiting for a peer to dial...")
+			conn, err = l.Accept(context.Background())
+			l.Close()
+		}
+	default:
+		flag.Usage()
+		return
+	}
 	if err != nil {
 		log.Fatalln(err)
 	}
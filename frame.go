@@ -0,0 +1,122 @@
+package connection
+
+import (
+	"errors"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Every data channel message is a frame: a type byte followed by the payload.
+// Messages larger than FrameSize are split in frameMore frames
+// terminated by a frameFinal one.
+// A frameClose frame, without payload, ends the default data channel.
+// framePing and framePong frames carry the sequence number of the
+// heartbeat, see HeartbeatPolicy.
+const (
+	frameFinal byte = iota // last (or only) fragment of a message
+	frameMore              // more fragments follow
+	frameClose             // the sender is closing the connection
+	framePing              // heartbeat request
+	framePong              // heartbeat answer, echoing the ping payload
+)
+
+const (
+	// Size in bytes of a frame, header included.
+	// Small enough for every SCTP implementation (browsers included)
+	FrameSize = 16 << 10
+	DefaultMaxMessageSize = 16 << 20
+)
+
+// Returned (or reported, by Send) when a message exceeds the maximum
+// message size
+var ErrMessageTooLarge = errors.New("Message too large")
+
+// Maximum message size of the settings, with default
+func (s *ConnectionSettings) maxMessageSize() int {
+	if s.MaxMessageSize == 0 {
+		return DefaultMaxMessageSize
+	}
+	return int(s.MaxMessageSize)
+}
+
+// True iff messages sent on dc arrive whole and in order,
+// which is required to split them
+func reliable(dc *webrtc.DataChannel) bool {
+	return dc.Ordered() && dc.MaxRetransmits() == nil && dc.MaxPacketLifeTime() == nil
+}
+
+// Largest message dc can send: messages are not split on unreliable
+// channels, so they must fit whole in an SCTP message, header included
+func messageLimit(dc *webrtc.DataChannel, maxSize int) int {
+	if reliable(dc) {
+		return maxSize
+	}
+	if t := dc.Transport(); t != nil {
+		if sctp := int(t.GetCapabilities().MaxMessageSize); sctp > 0 {
+			return min(maxSize, sctp-1)
+		}
+	}
+	return maxSize
+}
+
+// Splits msg in frames. If split is false a single frame is returned
+func frames(msg []byte, split bool) [][]byte {
+	const payload = FrameSize - 1
+	if !split || len(msg) <= payload {
+		return [][]byte{append([]byte{frameFinal}, msg...)}
+	}
+	result := make([][]byte, 0, (len(msg)+payload-1)/payload)
+	for len(msg) > payload {
+		result = append(result, append([]byte{frameMore}, msg[:payload]...))
+		msg = msg[payload:]
+	}
+	return append(result, append([]byte{frameFinal}, msg...))
+}
+
+// Rebuilds the messages from the received frames
+type reassembler struct {
+	buf []byte
+	max int
+	// true while dropping the fragments of a too large message
+	discard bool
+}
+
+// Adds a frame. Returns the message once its final frame is received.
+// Messages larger than max are dropped, returning ErrMessageTooLarge.
+func (r *reassembler) push(frame []byte) ([]byte, bool, error) {
+	if len(frame) == 0 {
+		return nil, false, errors.New("Empty frame")
+	}
+	kind, payload := frame[0], frame[1:]
+	switch kind {
+	case frameFinal, frameMore:
+	default:
+		return nil, false, errors.New("Unknown frame type")
+	}
+
+	if !r.discard && len(r.buf)+len(payload) > r.max {
+		r.discard = true
+		r.buf = nil
+		if kind == frameFinal {
+			r.discard = false
+		}
+		return nil, false, ErrMessageTooLarge
+	}
+	if r.discard {
+		if kind == frameFinal {
+			r.discard = false
+		}
+		return nil, false, nil
+	}
+
+	if kind == frameMore {
+		r.buf = append(r.buf, payload...)
+		return nil, false, nil
+	}
+	if r.buf == nil {
+		return payload, true, nil
+	}
+	msg := append(r.buf, payload...)
+	r.buf = nil
+	return msg, true, nil
+}
@@ -0,0 +1,157 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestReassembler(t *testing.T) {
+	msg := make([]byte, 3*FrameSize)
+	rand.Read(msg)
+	r := reassembler{max: len(msg)}
+
+	fs := frames(msg, true)
+	if len(fs) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(fs))
+	}
+	for i, f := range fs {
+		if len(f) > FrameSize {
+			t.Errorf("Frame %d is too large: %d", i, len(f))
+		}
+		out, ok, err := r.push(f)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ok != (i == len(fs)-1) {
+			t.Fatalf("Message completed at frame %d", i)
+		}
+		if ok && !bytes.Equal(out, msg) {
+			t.Errorf("Reassembled message differs")
+		}
+	}
+
+	// too large: dropped until the next message
+	r.max = FrameSize
+	var tooLarge int
+	for _, f := range fs {
+		if _, ok, err := r.push(f); ok {
+			t.Fatalf("Too large message should be dropped")
+		} else if errors.Is(err, ErrMessageTooLarge) {
+			tooLarge++
+		}
+	}
+	if tooLarge != 1 {
+		t.Errorf("Expected one ErrMessageTooLarge, got %d", tooLarge)
+	}
+	if out, ok, _ := r.push(frames([]byte("ok"), true)[0]); !ok || string(out) != "ok" {
+		t.Errorf("Next message not received after a dropped one")
+	}
+
+	if out, ok, _ := r.push(frames(nil, true)[0]); !ok || len(out) != 0 {
+		t.Errorf("Empty message not received")
+	}
+}
+
+func TestLargeMessage(t *testing.T) {
+	errs := make(chan error, 1)
+	offerer, answerer := connectPair(t, ConnectionSettings{
+		Key: "large",
+		MaxMessageSize: 2 << 20,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+
+	msg := make([]byte, 1<<20)
+	rand.Read(msg)
+	offerer.Send(msg)
+	if recv := answerer.Recv(); !bytes.Equal(recv, msg) {
+		t.Errorf("Received message differs: %d bytes instead of %d", len(recv), len(msg))
+	}
+
+	// over the limit: dropped by the sender
+	answerer.Send(make([]byte, 3<<20))
+	answerer.Send([]byte("small"))
+	if recv := offerer.Recv(); string(recv) != "small" {
+		t.Errorf("Expected small, got %d bytes", len(recv))
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrMessageTooLarge) {
+			t.Errorf("Expected ErrMessageTooLarge, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Too large message not reported")
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	// SCTP messages limited as in browsers
+	se := webrtc.SettingEngine{}
+	se.SetSCTPMaxMessageSize(64 << 10)
+	errs := make(chan error, 4)
+	offerer, answerer := connectPair(t, ConnectionSettings{
+		Key: "too-large",
+		MaxMessageSize: 1 << 20,
+		API: webrtc.NewAPI(webrtc.WithSettingEngine(se)),
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// rejected before queueing
+	if err := offerer.SendContext(ctx, make([]byte, 2<<20)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge, got %v", err)
+	}
+	if err := offerer.TrySend(make([]byte, 2<<20)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge from TrySend, got %v", err)
+	}
+
+	// unreliable channels do not split messages
+	lossy := &webrtc.DataChannelInit{Ordered: new(bool), MaxRetransmits: new(uint16)}
+	sender, err := offerer.OpenChannel("lossy", lossy)
+	if err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	receiver, err := answerer.AcceptChannel(ctx, "lossy")
+	if err != nil {
+		t.Fatalf("Channel not received: %v", err)
+	}
+	if err := sender.WaitOpen(ctx); err != nil {
+		t.Fatalf("Channel not open: %v", err)
+	}
+	if err := sender.SendContext(ctx, make([]byte, 128<<10)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge on an unreliable channel, got %v", err)
+	}
+
+	// past the checks, the message is dropped and the channel stays open
+	sender.In <- make([]byte, 128<<10)
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrMessageTooLarge) {
+			t.Errorf("Expected ErrMessageTooLarge, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Too large message not reported")
+	}
+	if err := sender.SendContext(ctx, []byte("small")); err != nil {
+		t.Fatalf("Channel closed by a too large message: %v", err)
+	}
+	if msg, err := receiver.RecvContext(ctx); err != nil || string(msg) != "small" {
+		t.Errorf("Expected small, got %q, %v", msg, err)
+	}
+}
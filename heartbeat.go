@@ -0,0 +1,136 @@
+package connection
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Keepalive on the default data channel, detecting a dead peer much
+// faster than ICE consent freshness.
+// Every Interval a ping frame is sent, which the remote peer answers
+// with a pong; the round trip time is reported by Stats.
+// After MaxMissed pings without pong (or not sent because the data
+// channel has been closed) the peer is unresponsive: a
+// StateHeartbeat event is published and, if Close is set, the connection
+// is closed with ErrPeerUnresponsive. A later pong makes it responsive again.
+// Pings are not counted as missed while a reconnection is in progress.
+type HeartbeatPolicy struct {
+	// Time between two pings, zero means DefaultHeartbeatInterval
+	Interval time.Duration
+	// Pings without pong before the peer is unresponsive,
+	// zero means DefaultHeartbeatMaxMissed
+	MaxMissed int
+	// Close the connection when the peer becomes unresponsive
+	Close bool
+}
+
+const (
+	DefaultHeartbeatInterval  = 2 * time.Second
+	DefaultHeartbeatMaxMissed = 3
+)
+
+// Policy pinging every 2 seconds, without closing the connection
+func DefaultHeartbeatPolicy() *HeartbeatPolicy {
+	return &HeartbeatPolicy{
+		Interval:  DefaultHeartbeatInterval,
+		MaxMissed: DefaultHeartbeatMaxMissed,
+	}
+}
+
+// State of the keepalive of a Connection
+type heartbeat struct {
+	// sequence number of the last ping
+	seq uint64
+	// time the last ping has been sent
+	sent time.Time
+	// true iff the last ping has not been answered yet
+	pending bool
+	missed  int
+	// round trip time of the last answered ping
+	rtt          time.Duration
+	unresponsive bool
+	mu           sync.Mutex
+}
+
+// Sends pings through dc until the connection is closed
+func (c *Connection) heartbeat(dc *webrtc.DataChannel, policy *HeartbeatPolicy) {
+	interval, maxMissed := policy.Interval, policy.MaxMissed
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	if maxMissed <= 0 {
+		maxMissed = DefaultHeartbeatMaxMissed
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.closed:
+			return
+		}
+		c.mu.Lock()
+		reconnecting := c.reconnecting
+		c.mu.Unlock()
+
+		hb := &c.hb
+		hb.mu.Lock()
+		if hb.pending && !reconnecting {
+			hb.missed++
+		}
+		lost := hb.missed >= maxMissed && !hb.unresponsive
+		if lost {
+			hb.unresponsive = true
+		}
+		hb.seq++
+		hb.sent = time.Now()
+		hb.pending = true
+		ping := binary.BigEndian.AppendUint64([]byte{framePing}, hb.seq)
+		hb.mu.Unlock()
+
+		if lost {
+			c.publish(StateEvent{Kind: StateHeartbeat, Unresponsive: true})
+			if policy.Close {
+				c.fail(PhaseDataChannel, ErrPeerUnresponsive)
+				return
+			}
+		}
+		// a closed channel or a failed send leaves the ping unanswered
+		if dc.ReadyState() == webrtc.DataChannelStateOpen {
+			dc.Send(ping)
+		}
+	}
+}
+
+// Handles a pong frame received from the remote peer
+func (c *Connection) pong(payload []byte) {
+	if len(payload) != 8 {
+		return
+	}
+	hb := &c.hb
+	hb.mu.Lock()
+	if hb.pending && binary.BigEndian.Uint64(payload) == hb.seq {
+		hb.pending = false
+		hb.rtt = time.Since(hb.sent)
+	}
+	// late pongs prove the peer alive, but do not measure the rtt
+	hb.missed = 0
+	recovered := hb.unresponsive
+	hb.unresponsive = false
+	hb.mu.Unlock()
+
+	if recovered {
+		c.publish(StateEvent{Kind: StateHeartbeat, Unresponsive: false})
+	}
+}
+
+// Round trip time of the last answered ping and responsiveness of the peer
+func (c *Connection) heartbeatState() (time.Duration, bool) {
+	c.hb.mu.Lock()
+	defer c.hb.mu.Unlock()
+	return c.hb.rtt, c.hb.unresponsive
+}
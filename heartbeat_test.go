@@ -0,0 +1,112 @@
+package connection
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Replaces the message handler of the default data channel of c with one
+// answering the pings only while silent is false
+func muteHeartbeat(c *Connection, silent *atomic.Bool) {
+	dc := c.dc
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if len(msg.Data) > 0 && msg.Data[0] == framePing && !silent.Load() {
+			dc.Send(append([]byte{framePong}, msg.Data[1:]...))
+		}
+	})
+}
+
+func TestHeartbeat(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{
+		Key:       "heartbeat",
+		Heartbeat: &HeartbeatPolicy{Interval: 50 * time.Millisecond, MaxMissed: 3},
+	})
+	events, cancel := offerer.Subscribe(16)
+	defer cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for offerer.Stats().HeartbeatRTT == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Heartbeat RTT not measured")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var silent atomic.Bool
+	silent.Store(true)
+	muteHeartbeat(answerer, &silent)
+	waitEvent(t, events, func(ev StateEvent) bool {
+		return ev.Kind == StateHeartbeat && ev.Unresponsive
+	})
+	if !offerer.States().Unresponsive {
+		t.Errorf("Peer should be unresponsive")
+	}
+
+	silent.Store(false)
+	waitEvent(t, events, func(ev StateEvent) bool {
+		return ev.Kind == StateHeartbeat && !ev.Unresponsive
+	})
+	if offerer.Stats().Unresponsive {
+		t.Errorf("Peer should be responsive again")
+	}
+	select {
+	case <-offerer.Done():
+		t.Errorf("Connection should stay open without Close")
+	default:
+	}
+}
+
+// Connects a peer with the heartbeat policy to one without heartbeat,
+// returned in this order
+func connectHeartbeat(t *testing.T, key string, policy *HeartbeatPolicy) (*Connection, *Connection) {
+	t.Helper()
+	c1, c2 := connectPairWith(t,
+		ConnectionSettings{Key: key, Heartbeat: policy},
+		ConnectionSettings{Key: key},
+	)
+	if c1.Settings.Heartbeat == nil {
+		return c2, c1
+	}
+	return c1, c2
+}
+
+// Waits for c to be closed because its peer is unresponsive
+func waitUnresponsive(t *testing.T, c *Connection) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Connection not closed")
+	}
+	if !errors.Is(c.Err(), ErrPeerUnresponsive) {
+		t.Errorf("Expected ErrPeerUnresponsive, got %v", c.Err())
+	}
+}
+
+func TestHeartbeatClose(t *testing.T) {
+	pinging, peer := connectHeartbeat(t, "heartbeat-close",
+		&HeartbeatPolicy{Interval: 50 * time.Millisecond, MaxMissed: 2, Close: true})
+	// the peer stops answering
+	var silent atomic.Bool
+	silent.Store(true)
+	muteHeartbeat(peer, &silent)
+	waitUnresponsive(t, pinging)
+}
+
+func TestHeartbeatChannelClosed(t *testing.T) {
+	pinging, peer := connectHeartbeat(t, "heartbeat-closed",
+		&HeartbeatPolicy{Interval: 50 * time.Millisecond, MaxMissed: 2, Close: true})
+	events, cancel := pinging.Subscribe(16)
+	defer cancel()
+
+	// the peer goes away without notice, closing the data channel
+	peer.CloseAll()
+	waitEvent(t, events, func(ev StateEvent) bool {
+		return ev.Kind == StateHeartbeat && ev.Unresponsive
+	})
+	waitUnresponsive(t, pinging)
+}
@@ -0,0 +1,124 @@
+package connection
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Validity of the certificates made by LoadOrCreateCertificate.
+// Pinned fingerprints change with the certificate, hence the long validity
+const CertificateValidity = 10 * 365 * 24 * time.Hour
+
+// Loads a certificate and its private key from a PEM file
+func LoadCertificate(path string) (*webrtc.Certificate, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return webrtc.CertificateFromPEM(string(pem))
+}
+
+// Saves a certificate and its private key to a PEM file, readable by the owner only
+func SaveCertificate(cert *webrtc.Certificate, path string) error {
+	pem, err := cert.PEM()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(pem), 0o600)
+}
+
+// Loads the certificate at path, or creates it if the file does not exist
+func LoadOrCreateCertificate(path string) (*webrtc.Certificate, error) {
+	cert, err := LoadCertificate(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return cert, err
+	}
+	if cert, err = NewCertificate(CertificateValidity); err != nil {
+		return nil, err
+	}
+	return cert, SaveCertificate(cert, path)
+}
+
+// Generates an ECDSA certificate valid for the given duration
+func NewCertificate(validity time.Duration) (*webrtc.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return webrtc.NewCertificate(key, x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "directchan"},
+		NotBefore:    now.Add(-24 * time.Hour),
+		NotAfter:     now.Add(validity),
+	})
+}
+
+// SHA-256 fingerprint of cert, in the SDP format ("sha-256 AB:CD:...")
+func Fingerprint(cert *webrtc.Certificate) (string, error) {
+	fingerprints, err := cert.GetFingerprints()
+	if err != nil {
+		return "", err
+	}
+	for _, f := range fingerprints {
+		if f.Algorithm == "sha-256" {
+			return normalizeFingerprint(f.Algorithm + " " + f.Value), nil
+		}
+	}
+	return "", errors.New("No SHA-256 fingerprint")
+}
+
+// Lower case algorithm and upper case value, separated by one space
+func normalizeFingerprint(f string) string {
+	algorithm, value, _ := strings.Cut(strings.TrimSpace(f), " ")
+	return strings.ToLower(algorithm) + " " + strings.ToUpper(strings.TrimSpace(value))
+}
+
+// Fails with ErrUntrustedPeer unless all the fingerprints of sdp are trusted
+func (s *ConnectionSettings) verifyFingerprints(sdp webrtc.SessionDescription) error {
+	if len(s.TrustedFingerprints) == 0 {
+		return nil
+	}
+	parsed, err := sdp.Unmarshal()
+	if err != nil {
+		return err
+	}
+	var fingerprints []string
+	if f, ok := parsed.Attribute("fingerprint"); ok {
+		fingerprints = append(fingerprints, f)
+	}
+	for _, media := range parsed.MediaDescriptions {
+		if f, ok := media.Attribute("fingerprint"); ok {
+			fingerprints = append(fingerprints, f)
+		}
+	}
+	if len(fingerprints) == 0 {
+		return ErrUntrustedPeer
+	}
+
+	trusted := make([]string, len(s.TrustedFingerprints))
+	for i, f := range s.TrustedFingerprints {
+		trusted[i] = normalizeFingerprint(f)
+	}
+	for _, f := range fingerprints {
+		if !slices.Contains(trusted, normalizeFingerprint(f)) {
+			return ErrUntrustedPeer
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// New certificate and its fingerprint
+func newIdentity(t *testing.T) (*webrtc.Certificate, string) {
+	t.Helper()
+	cert, err := NewCertificate(time.Hour)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	fingerprint, err := Fingerprint(cert)
+	if err != nil {
+		t.Fatalf("Cannot compute fingerprint: %v", err)
+	}
+	return cert, fingerprint
+}
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identity.pem")
+	created, err := LoadOrCreateCertificate(path)
+	if err != nil {
+		t.Fatalf("Cannot create certificate: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Unexpected certificate file: %v, %v", info, err)
+	}
+	loaded, err := LoadOrCreateCertificate(path)
+	if err != nil {
+		t.Fatalf("Cannot load certificate: %v", err)
+	}
+	f1, _ := Fingerprint(created)
+	f2, _ := Fingerprint(loaded)
+	if f1 != f2 {
+		t.Errorf("Loaded fingerprint %s differs from %s", f2, f1)
+	}
+	if loaded.Expires().Before(time.Now().Add(CertificateValidity - 48*time.Hour)) {
+		t.Errorf("Unexpected expiration %v", loaded.Expires())
+	}
+}
+
+func TestPinnedCertificates(t *testing.T) {
+	cert1, f1 := newIdentity(t)
+	cert2, f2 := newIdentity(t)
+	connectPairWith(t,
+		// fingerprints are matched case-insensitively
+		ConnectionSettings{Key: "pinned", Certificate: cert1, TrustedFingerprints: []string{strings.ToLower(f2)}},
+		ConnectionSettings{Key: "pinned", Certificate: cert2, TrustedFingerprints: []string{f1}},
+	)
+}
+
+func TestUntrustedPeer(t *testing.T) {
+	cert1, _ := newIdentity(t)
+	cert2, _ := newIdentity(t)
+	_, other := newIdentity(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res := make(chan error, 1)
+	go func() {
+		c, err := FromSettingsContext(ctx, &ConnectionSettings{
+			Signaling: signalingURL, Key: "untrusted", BufferSize: 1, Certificate: cert2,
+		})
+		if err == nil {
+			c.CloseAll()
+		}
+		res <- err
+	}()
+	c, err := FromSettingsContext(ctx, &ConnectionSettings{
+		Signaling: signalingURL, Key: "untrusted", BufferSize: 1,
+		Certificate: cert1, TrustedFingerprints: []string{other},
+	})
+	if err == nil {
+		c.CloseAll()
+	}
+	if !errors.Is(err, ErrUntrustedPeer) {
+		t.Errorf("Expected ErrUntrustedPeer, got %v", err)
+	}
+	if err := <-res; err == nil {
+		t.Errorf("Remote peer should not connect")
+	}
+}
@@ -0,0 +1,158 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Two-way channel reporting its errors and honouring contexts.
+// Once the channel is closed, SendContext returns net.ErrClosed and
+// RecvContext returns io.EOF after the messages already received.
+type IOChannelContext interface {
+	SendContext(ctx context.Context, b []byte) error
+	RecvContext(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+var (
+	_ IOChannelContext = (*Connection)(nil)
+	_ IOChannelContext = (*Channel)(nil)
+	_ IOChannelContext = (*AESConnection)(nil)
+	_ IOChannelContext = (*Dispatcher)(nil)
+	_ IOChannelContext = (*DummyConnection)(nil)
+)
+
+// Adapts an IOChannel to IOChannelContext.
+// Channels already implementing IOChannelContext are returned as they are.
+// Send and Recv of ch cannot be interrupted: when ctx is done first
+// they complete in background, and a received message is lost.
+// Closing ch must unblock its pending Send and Recv.
+func AdaptIOChannel(ch IOChannel) IOChannelContext {
+	if c, ok := ch.(IOChannelContext); ok {
+		return c
+	}
+	return &ioChannelAdapter{ch: ch, closed: make(chan struct{})}
+}
+
+type ioChannelAdapter struct {
+	ch IOChannel
+	// closed by Close
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (a *ioChannelAdapter) SendContext(ctx context.Context, b []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-a.closed:
+		return net.ErrClosed
+	default:
+	}
+	done := make(chan struct{})
+	go func() {
+		a.ch.Send(b)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-a.closed:
+		return net.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *ioChannelAdapter) RecvContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	done := make(chan []byte, 1)
+	go func() { done <- a.ch.Recv() }()
+	select {
+	case msg := <-done:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Closes ch if it has a Close method
+func (a *ioChannelAdapter) Close() error {
+	a.closeOnce.Do(func() { close(a.closed) })
+	switch c := a.ch.(type) {
+	case interface{ Close() error }:
+		return c.Close()
+	case interface{ Close() }:
+		c.Close()
+	}
+	return nil
+}
+
+// Sends b to in, failing if done is closed first.
+// in is never closed: senders are stopped by done instead.
+func sendContext(ctx context.Context, in chan []byte, done <-chan struct{}, b []byte) error {
+	select {
+	case <-done:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case in <- b:
+		return nil
+	case <-done:
+		return net.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Same as sendContext, but returns ErrWouldBlock instead of blocking
+func trySend(in chan []byte, done <-chan struct{}, b []byte) error {
+	select {
+	case <-done:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case in <- b:
+		return nil
+	default:
+		return ErrWouldBlock
+	}
+}
+
+// Guard of an output buffer written by the message handler of a data
+// channel and closed by another goroutine: once closed, deliver drops
+// the messages, so that the buffer is never written after close
+type output struct {
+	closed bool
+	mu     sync.Mutex
+}
+
+// Sends data to out, unless the guard is closed.
+// Gives up when done is closed, which must happen before close.
+func (o *output) deliver(out chan []byte, done <-chan struct{}, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	select {
+	case out <- data:
+	case <-done:
+	}
+}
+
+// Closes out once no message is being delivered
+func (o *output) close(out chan []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		close(out)
+	}
+}
@@ -0,0 +1,172 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectionContext(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "iochannel", BufferSize: 8})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := offerer.SendContext(ctx, []byte("hello")); err != nil {
+		t.Fatalf("Cannot send: %v", err)
+	}
+	msg, err := answerer.RecvContext(ctx)
+	if err != nil {
+		t.Fatalf("Cannot receive: %v", err)
+	}
+	if string(msg) != "hello" {
+		t.Errorf("Expected hello, got %q", msg)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := answerer.RecvContext(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	offerer.CloseAll()
+	if err := offerer.SendContext(ctx, []byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed after close, got %v", err)
+	}
+	if _, err := offerer.RecvContext(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF after close, got %v", err)
+	}
+}
+
+func TestDummyConnectionContext(t *testing.T) {
+	c1, c2 := NewDummyConnection(), NewDummyConnection()
+	c1.Connect(c2)
+	ctx := context.Background()
+
+	if err := c1.SendContext(ctx, []byte("ping")); err != nil {
+		t.Fatalf("Cannot send: %v", err)
+	}
+	c1.Close()
+	// pending messages are still delivered
+	if msg, err := c2.RecvContext(ctx); err != nil || string(msg) != "ping" {
+		t.Errorf("Expected ping, got %q, %v", msg, err)
+	}
+	if _, err := c2.RecvContext(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+	if err := c2.SendContext(ctx, []byte("pong")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestAESConnectionContext(t *testing.T) {
+	c1, c2 := NewDummyConnection(), NewDummyConnection()
+	c1.Connect(c2)
+	cypher, err := NewAESGCM(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a1, a2 := NewAESConnection(c1, cypher), NewAESConnection(c2, cypher)
+	ctx := context.Background()
+
+	if err := a1.SendContext(ctx, []byte("secret")); err != nil {
+		t.Fatalf("Cannot send: %v", err)
+	}
+	if msg, err := a2.RecvContext(ctx); err != nil || string(msg) != "secret" {
+		t.Errorf("Expected secret, got %q, %v", msg, err)
+	}
+
+	// tampered messages are reported instead of returned
+	c1.Send([]byte("short"))
+	if _, err := a2.RecvContext(ctx); err == nil {
+		t.Errorf("Expected an error for a malformed message")
+	}
+	c1.Send(bytes.Repeat([]byte{0}, 64))
+	if _, err := a2.RecvContext(ctx); err == nil {
+		t.Errorf("Expected an error for a tampered message")
+	}
+
+	// the closure of a plain IOChannel is remembered
+	plain := NewAESConnection(&plainChannel{make(chan []byte, 1), make(chan struct{})}, cypher)
+	plain.Close()
+	if err := plain.SendContext(ctx, []byte("closed")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
+
+// IOChannel without the context methods
+type plainChannel struct {
+	ch   chan []byte
+	done chan struct{}
+}
+
+func (p *plainChannel) Send(b []byte) {
+	select {
+	case p.ch <- b:
+	case <-p.done:
+	}
+}
+
+func (p *plainChannel) Recv() []byte {
+	select {
+	case b := <-p.ch:
+		return b
+	case <-p.done:
+		return nil
+	}
+}
+
+func (p *plainChannel) Close() { close(p.done) }
+
+func TestAdaptIOChannel(t *testing.T) {
+	if _, ok := AdaptIOChannel(NewDummyConnection()).(*DummyConnection); !ok {
+		t.Errorf("Channels implementing IOChannelContext should not be wrapped")
+	}
+
+	adapted := AdaptIOChannel(&plainChannel{make(chan []byte), make(chan struct{})})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := adapted.SendContext(ctx, []byte("blocked")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+
+	adapted.Close()
+	if err := adapted.SendContext(context.Background(), []byte("closed")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestCloseWhileReceiving(t *testing.T) {
+	sender, receiver := connectPair(t, ConnectionSettings{Key: "close-receiving", BufferSize: 4})
+
+	// the sender streams while the receiver, not reading, closes
+	stop := make(chan struct{})
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if errors.Is(sender.TrySend([]byte("stream")), net.ErrClosed) {
+				return
+			}
+		}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	receiver.CloseAll()
+	close(stop)
+	<-streamed
+
+	for range receiver.Out {
+	}
+	if err := receiver.TrySend([]byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+	receiver.Send([]byte("dropped"))
+}
@@ -0,0 +1,89 @@
+package connection
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/pion/logging"
+)
+
+// Level of the pion trace messages, below slog.LevelDebug
+const LevelTrace = slog.LevelDebug - 4
+
+// Identifies a key in the logs without revealing it:
+// the first 8 bytes of its SHA-256, in hex
+func KeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Logger of the settings with the key hash,
+// discarding everything if not set
+func (s *ConnectionSettings) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	if s.Key == "" {
+		return s.Logger
+	}
+	return s.Logger.With("key", KeyHash(s.Key))
+}
+
+// Current logger of the connection, with its key and role
+func (c *Connection) logger() *slog.Logger {
+	if l := c.log.Load(); l != nil {
+		return l
+	}
+	return c.Settings.logger()
+}
+
+// Adds the role decided by the signaler to the logger
+func (c *Connection) logRole(offer bool) {
+	role := "answerer"
+	if offer {
+		role = "offerer"
+	}
+	c.log.Store(c.Settings.logger().With("role", role))
+}
+
+// Routes the logs of pion to l, with the pion scope in the "scope" field
+func NewLoggerFactory(l *slog.Logger) logging.LoggerFactory {
+	return &loggerFactory{l: l.With("component", "pion")}
+}
+
+type loggerFactory struct {
+	l *slog.Logger
+}
+
+func (f *loggerFactory) NewLogger(scope string) logging.LeveledLogger {
+	return &leveledLogger{l: f.l.With("scope", scope)}
+}
+
+// pion logger writing to a slog.Logger
+type leveledLogger struct {
+	l *slog.Logger
+}
+
+func (l *leveledLogger) log(level slog.Level, msg string) {
+	l.l.Log(context.Background(), level, msg)
+}
+
+func (l *leveledLogger) logf(level slog.Level, format string, args ...any) {
+	if l.l.Enabled(context.Background(), level) {
+		l.log(level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *leveledLogger) Trace(msg string)                  { l.log(LevelTrace, msg) }
+func (l *leveledLogger) Tracef(format string, args ...any) { l.logf(LevelTrace, format, args...) }
+func (l *leveledLogger) Debug(msg string)                  { l.log(slog.LevelDebug, msg) }
+func (l *leveledLogger) Debugf(format string, args ...any) { l.logf(slog.LevelDebug, format, args...) }
+func (l *leveledLogger) Info(msg string)                   { l.log(slog.LevelInfo, msg) }
+func (l *leveledLogger) Infof(format string, args ...any)  { l.logf(slog.LevelInfo, format, args...) }
+func (l *leveledLogger) Warn(msg string)                   { l.log(slog.LevelWarn, msg) }
+func (l *leveledLogger) Warnf(format string, args ...any)  { l.logf(slog.LevelWarn, format, args...) }
+func (l *leveledLogger) Error(msg string)                  { l.log(slog.LevelError, msg) }
+func (l *leveledLogger) Errorf(format string, args ...any) { l.logf(slog.LevelError, format, args...) }
@@ -0,0 +1,76 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Buffer safe for concurrent writes
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Decoded JSON records written so far
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(b.buf.Bytes()), []byte("\n")) {
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("Bad log record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestKeyHash(t *testing.T) {
+	if KeyHash("secret") != KeyHash("secret") {
+		t.Errorf("Hash should be stable")
+	}
+	if KeyHash("secret") == KeyHash("other") {
+		t.Errorf("Different keys should have different hashes")
+	}
+	if len(KeyHash("secret")) != 16 || strings.Contains(KeyHash("secret"), "secret") {
+		t.Errorf("Unexpected hash %s", KeyHash("secret"))
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: LevelTrace}))
+	offerer, _ := connectPair(t, ConnectionSettings{Key: "logger", Logger: logger})
+	offerer.CloseAll()
+
+	var connected, state, closed, pion bool
+	for _, record := range buf.records(t) {
+		if key, ok := record["key"]; ok && key != KeyHash("logger") {
+			t.Errorf("Unexpected key %v", key)
+		}
+		switch {
+		case record["component"] == "pion":
+			pion = record["scope"] != nil
+		case record["msg"] == "signaling connected":
+			connected = record["role"] == "offerer" || record["role"] == "answerer"
+		case record["msg"] == "state changed":
+			state = record["state"] != nil && record["role"] != nil
+		case record["msg"] == "connection closed":
+			closed = true
+		}
+	}
+	if !connected || !state || !closed || !pion {
+		t.Errorf("Missing records: connected %v, state %v, closed %v, pion %v", connected, state, closed, pion)
+	}
+}
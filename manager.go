@@ -0,0 +1,296 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+)
+
+// Kind of a PeerEvent
+type PeerEventKind int
+
+const (
+	PeerJoined PeerEventKind = iota // the data channel with the peer is open
+	PeerLeft                        // the connection has been closed
+	PeerFailed                      // the connection could not be made, or failed (see Err)
+)
+
+func (k PeerEventKind) String() string {
+	switch k {
+	case PeerJoined:
+		return "joined"
+	case PeerLeft:
+		return "left"
+	case PeerFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// A change of the peers of a Manager
+type PeerEvent struct {
+	Kind PeerEventKind
+	Key  string
+	// Reason of the failure, for PeerFailed
+	Err error
+}
+
+// A message received from the peer of Key
+type PeerMessage struct {
+	Key  string
+	Data []byte
+}
+
+var (
+	// Returned when connecting to a key already managed
+	ErrPeerExists = errors.New("Peer already connected")
+	// Returned for a key not managed
+	ErrUnknownPeer = errors.New("Unknown peer")
+)
+
+// Connections with many peers, by key.
+// The connections share the settings given to NewManager, Key apart,
+// and a single pion API. They are forgotten once closed.
+type Manager struct {
+	// Messages received from all the peers, tagged with their key.
+	// Closed by Close. A peer is blocked while Out is full.
+	Out chan PeerMessage
+
+	settings ConnectionSettings
+	// connections by key, nil while connecting
+	conns  map[string]*Connection
+	events *broadcaster[PeerEvent]
+	// closed by Close
+	closed   chan struct{}
+	isClosed bool
+	// running forwarders to Out
+	forwarders sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// Instantiates a manager making connections with settings.
+// A shared API is built from settings, unless settings.API is set.
+func NewManager(settings *ConnectionSettings) (*Manager, error) {
+	if settings.BufferSize == 0 {
+		return nil, errors.New("Buffer size must be greater than 0")
+	}
+	s := *settings
+	s.Key = ""
+	if s.API == nil {
+		api, err := NewAPI(&s)
+		if err != nil {
+			return nil, err
+		}
+		s.API = api
+	}
+	return &Manager{
+		Out:      make(chan PeerMessage, s.BufferSize),
+		settings: s,
+		conns:    make(map[string]*Connection),
+		events:   newBroadcaster[PeerEvent](),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+// Settings of the connection with the peer of key, e.g. for Listen
+func (m *Manager) Settings(key string) *ConnectionSettings {
+	s := m.settings
+	s.Key = key
+	return &s
+}
+
+// Connects to the peer of key, see FromSettingsContext
+func (m *Manager) Connect(ctx context.Context, key string) (*Connection, error) {
+	return m.open(key, func(s *ConnectionSettings) (*Connection, error) {
+		return FromSettingsContext(ctx, s)
+	})
+}
+
+// Dials the peer listening on key, see Dial
+func (m *Manager) Dial(ctx context.Context, key string) (*Connection, error) {
+	return m.open(key, func(s *ConnectionSettings) (*Connection, error) {
+		return Dial(ctx, s)
+	})
+}
+
+// Manages a connection made elsewhere, e.g. accepted by a Listener
+// built with Settings, under the key of its settings
+func (m *Manager) Add(c *Connection) error {
+	key := c.Settings.Key
+	if err := m.reserve(key); err != nil {
+		return err
+	}
+	return m.track(key, c)
+}
+
+// Reserves key for a connection, failing if it is already managed
+func (m *Manager) reserve(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isClosed {
+		return net.ErrClosed
+	}
+	if _, ok := m.conns[key]; ok {
+		return ErrPeerExists
+	}
+	m.conns[key] = nil
+	return nil
+}
+
+// Opens the connection with the peer of key and manages it
+func (m *Manager) open(key string, open func(*ConnectionSettings) (*Connection, error)) (*Connection, error) {
+	if err := m.reserve(key); err != nil {
+		return nil, err
+	}
+	c, err := open(m.Settings(key))
+	if err != nil {
+		m.mu.Lock()
+		delete(m.conns, key)
+		m.mu.Unlock()
+		m.events.publish(PeerEvent{Kind: PeerFailed, Key: key, Err: err})
+		return nil, err
+	}
+	if err := m.track(key, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Starts forwarding the messages of c, reserved under key
+func (m *Manager) track(key string, c *Connection) error {
+	m.mu.Lock()
+	if m.isClosed {
+		delete(m.conns, key)
+		m.mu.Unlock()
+		c.CloseAll()
+		return net.ErrClosed
+	}
+	m.conns[key] = c
+	m.forwarders.Add(1)
+	m.mu.Unlock()
+
+	m.events.publish(PeerEvent{Kind: PeerJoined, Key: key})
+	go m.forward(key, c)
+	return nil
+}
+
+// Tags the messages of c until it is closed, then forgets it
+func (m *Manager) forward(key string, c *Connection) {
+	defer m.forwarders.Done()
+	for data := range c.Out {
+		select {
+		case m.Out <- PeerMessage{Key: key, Data: data}:
+		case <-m.closed:
+			// nobody reads anymore
+		}
+	}
+
+	m.mu.Lock()
+	if m.conns[key] == c {
+		delete(m.conns, key)
+	}
+	m.mu.Unlock()
+	if err := c.Err(); err != nil {
+		m.events.publish(PeerEvent{Kind: PeerFailed, Key: key, Err: err})
+	} else {
+		m.events.publish(PeerEvent{Kind: PeerLeft, Key: key})
+	}
+}
+
+// Connection with the peer of key, nil if not connected
+func (m *Manager) Get(key string) *Connection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conns[key]
+}
+
+// Keys of the connected peers, sorted
+func (m *Manager) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.conns))
+	for key, c := range m.conns {
+		if c != nil {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Sends b to the peer of key, see Connection.SendContext
+func (m *Manager) Send(ctx context.Context, key string, b []byte) error {
+	c := m.Get(key)
+	if c == nil {
+		return ErrUnknownPeer
+	}
+	return c.SendContext(ctx, b)
+}
+
+// Receives the next message of any peer.
+// Returns io.EOF once the manager is closed.
+func (m *Manager) Recv(ctx context.Context) (PeerMessage, error) {
+	select {
+	case msg, ok := <-m.Out:
+		if !ok {
+			return PeerMessage{}, io.EOF
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return PeerMessage{}, ctx.Err()
+	}
+}
+
+// Subscribes to the peer events, dropping the oldest ones when
+// the subscriber falls behind as Connection.Subscribe does.
+// The channel is closed by cancel, or once the manager is closed.
+func (m *Manager) Subscribe(size int) (<-chan PeerEvent, func()) {
+	return m.events.subscribe(size)
+}
+
+// Closes the connection with the peer of key gracefully, see Connection.Close
+func (m *Manager) ClosePeer(key string) error {
+	c := m.Get(key)
+	if c == nil {
+		return ErrUnknownPeer
+	}
+	return c.Close()
+}
+
+// Closes all the connections gracefully and in parallel, then Out and
+// the subscriptions, after the PeerLeft events.
+// Connections being made are closed once ready.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.isClosed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.isClosed = true
+	close(m.closed)
+	var conns []*Connection
+	for _, c := range m.conns {
+		if c != nil {
+			conns = append(conns, c)
+		}
+	}
+	m.mu.Unlock()
+
+	errs := make([]error, len(conns))
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.Close()
+		}()
+	}
+	wg.Wait()
+	m.forwarders.Wait()
+	close(m.Out)
+	m.events.close()
+	return errors.Join(errs...)
+}
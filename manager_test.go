@@ -0,0 +1,180 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Waits for an event of the given kind and key
+func waitPeerEvent(t *testing.T, events <-chan PeerEvent, kind PeerEventKind, key string) PeerEvent {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("Subscription closed")
+			}
+			if ev.Kind == kind && ev.Key == key {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("Event %v of %s not received", kind, key)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	m, err := NewManager(&ConnectionSettings{Signaling: signalingURL, BufferSize: 4, Network: labNetwork()})
+	if err != nil {
+		t.Fatalf("Cannot create manager: %v", err)
+	}
+	events, _ := m.Subscribe(32)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	keys := []string{"manager-a", "manager-b", "manager-c"}
+	remotes := make(map[string]*Connection)
+	for _, key := range keys {
+		res := make(chan error, 1)
+		go func() {
+			_, err := m.Connect(ctx, key)
+			res <- err
+		}()
+		remote, err := FromSettingsContext(ctx, &ConnectionSettings{Signaling: signalingURL, Key: key, BufferSize: 4})
+		if err != nil {
+			t.Fatalf("Remote %s cannot connect: %v", key, err)
+		}
+		defer remote.CloseAll()
+		if err := <-res; err != nil {
+			t.Fatalf("Manager cannot connect to %s: %v", key, err)
+		}
+		remotes[key] = remote
+		waitPeerEvent(t, events, PeerJoined, key)
+	}
+	if !slices.Equal(m.Keys(), keys) {
+		t.Errorf("Expected keys %v, got %v", keys, m.Keys())
+	}
+	if m.Get(keys[0]).Settings.API != m.Get(keys[1]).Settings.API {
+		t.Errorf("Connections should share the API")
+	}
+	if _, err := m.Connect(ctx, keys[0]); !errors.Is(err, ErrPeerExists) {
+		t.Errorf("Expected ErrPeerExists, got %v", err)
+	}
+
+	// merged receive stream
+	for _, key := range keys {
+		remotes[key].Send([]byte("from " + key))
+	}
+	for range keys {
+		msg, err := m.Recv(ctx)
+		if err != nil {
+			t.Fatalf("Cannot receive: %v", err)
+		}
+		if string(msg.Data) != "from "+msg.Key {
+			t.Errorf("Message %q tagged with %s", msg.Data, msg.Key)
+		}
+	}
+	for _, key := range keys {
+		if err := m.Send(ctx, key, []byte("to "+key)); err != nil {
+			t.Fatalf("Cannot send to %s: %v", key, err)
+		}
+		if msg := remotes[key].Recv(); string(msg) != "to "+key {
+			t.Errorf("Remote %s received %q", key, msg)
+		}
+	}
+	if err := m.Send(ctx, "manager-unknown", nil); !errors.Is(err, ErrUnknownPeer) {
+		t.Errorf("Expected ErrUnknownPeer, got %v", err)
+	}
+
+	// a peer leaves
+	remotes[keys[0]].Close()
+	waitPeerEvent(t, events, PeerLeft, keys[0])
+	if m.Get(keys[0]) != nil {
+		t.Errorf("Closed connection should be forgotten")
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Cannot close manager: %v", err)
+	}
+	// the peers are closed in parallel, in any order
+	left := map[string]bool{}
+	for ev := range events {
+		if ev.Kind == PeerLeft {
+			left[ev.Key] = true
+		}
+	}
+	for _, key := range keys[1:] {
+		if !left[key] {
+			t.Errorf("Missing PeerLeft event of %s", key)
+		}
+	}
+	if _, err := m.Recv(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+	if len(m.Keys()) != 0 {
+		t.Errorf("Expected no keys, got %v", m.Keys())
+	}
+}
+
+func TestManagerConnectFailure(t *testing.T) {
+	m, err := NewManager(&ConnectionSettings{Signaling: signalingURL, BufferSize: 1})
+	if err != nil {
+		t.Fatalf("Cannot create manager: %v", err)
+	}
+	defer m.Close()
+	events, _ := m.Subscribe(4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := m.Connect(ctx, "manager-alone"); err == nil {
+		t.Fatalf("Expected an error without remote peer")
+	}
+	if ev := waitPeerEvent(t, events, PeerFailed, "manager-alone"); ev.Err == nil {
+		t.Errorf("PeerFailed should carry the error")
+	}
+	if m.Get("manager-alone") != nil || len(m.Keys()) != 0 {
+		t.Errorf("Failed peer should not be managed")
+	}
+}
+
+func TestManagerPeerFailed(t *testing.T) {
+	settings := ConnectionSettings{Signaling: signalingURL, BufferSize: 1, Network: failFastNetwork()}
+	m, err := NewManager(&settings)
+	if err != nil {
+		t.Fatalf("Cannot create manager: %v", err)
+	}
+	defer m.Close()
+	events, _ := m.Subscribe(8)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res := make(chan error, 1)
+	go func() {
+		_, err := m.Connect(ctx, "manager-failed")
+		res <- err
+	}()
+	remote := settings
+	remote.Key = "manager-failed"
+	peer, err := FromSettingsContext(ctx, &remote)
+	if err != nil {
+		t.Fatalf("Remote cannot connect: %v", err)
+	}
+	defer peer.CloseAll()
+	if err := <-res; err != nil {
+		t.Fatalf("Manager cannot connect: %v", err)
+	}
+	waitPeerEvent(t, events, PeerJoined, "manager-failed")
+
+	vanish(peer)
+	if ev := waitPeerEvent(t, events, PeerFailed, "manager-failed"); !errors.Is(ev.Err, ErrPeerFailed) {
+		t.Errorf("Expected ErrPeerFailed, got %v", ev.Err)
+	}
+	if m.Get("manager-failed") != nil {
+		t.Errorf("Failed peer should be forgotten")
+	}
+}
@@ -0,0 +1,204 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Signaler for pairing without signaling server: the description and
+// all the candidates of a peer are written to out as a single line of
+// text (a blob) once gathering is complete, and the blob of the remote
+// peer is read as a line from in. The blobs are copied between the two
+// machines by hand.
+// The offerer writes its blob first, the answerer replies with its own.
+// Renegotiations need a new exchange, so they are not supported.
+type ManualSignaler struct {
+	offer bool
+	in    *bufio.Reader
+	out   io.Writer
+
+	// messages of the local blob being built
+	local []Message
+	// messages of the remote blob not yet returned by Recv
+	remote chan Message
+	// reason why the remote blob could not be read
+	readErr error
+	// held while reading in
+	readMu sync.Mutex
+	// closed by Close
+	closed chan struct{}
+	mu     sync.Mutex
+}
+
+var _ Signaler = (*ManualSignaler)(nil)
+
+// offer sets the role of the local peer, which must be the opposite
+// of the remote one
+func NewManualSignaler(offer bool, in io.Reader, out io.Writer) *ManualSignaler {
+	return &ManualSignaler{offer: offer, in: bufio.NewReader(in), out: out}
+}
+
+// Starts a new exchange of blobs
+func (s *ManualSignaler) Connect(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return s.offer, err
+	}
+	s.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.local = nil
+	s.remote = nil
+	s.readErr = nil
+	s.closed = make(chan struct{})
+	return s.offer, nil
+}
+
+// Collects msg in the local blob, which is written at the end of candidates
+func (s *ManualSignaler) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed == nil {
+		return net.ErrClosed
+	}
+	switch msg.Type {
+	case MessageOffer, MessageAnswer:
+		for _, m := range s.local {
+			if m.Type == MessageOffer || m.Type == MessageAnswer {
+				return errors.New("Manual signaling does not support renegotiation")
+			}
+		}
+	case MessageCandidate:
+	case MessageEndOfCandidates:
+		blob, err := encodeBlob(append(s.local, msg))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(s.out, blob+"\n")
+		return err
+	case MessageError:
+		// nobody to tell
+		return nil
+	default:
+		return errors.New("Manual signaling does not support " + string(msg.Type) + " messages")
+	}
+	s.local = append(s.local, msg)
+	return nil
+}
+
+// Returns the messages of the remote blob, reading it on the first call.
+// Once they have all been returned, blocks until Close.
+func (s *ManualSignaler) Recv() (Message, error) {
+	s.mu.Lock()
+	closed, remote := s.closed, s.remote
+	if closed == nil {
+		s.mu.Unlock()
+		return Message{}, net.ErrClosed
+	}
+	if remote == nil {
+		remote = make(chan Message)
+		s.remote = remote
+		go s.readBlob(remote, closed)
+	}
+	s.mu.Unlock()
+
+	select {
+	case msg, ok := <-remote:
+		if !ok {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return Message{}, s.readErr
+		}
+		return msg, msg.validate()
+	case <-closed:
+		return Message{}, net.ErrClosed
+	}
+}
+
+// Reads the remote blob and feeds its messages to remote.
+// remote is closed if the blob cannot be read.
+func (s *ManualSignaler) readBlob(remote chan Message, closed chan struct{}) {
+	msgs, err := s.readLine()
+	if err != nil {
+		s.mu.Lock()
+		s.readErr = err
+		s.mu.Unlock()
+		close(remote)
+		return
+	}
+	for _, msg := range msgs {
+		select {
+		case remote <- msg:
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Decodes the first non empty line of in
+func (s *ManualSignaler) readLine() ([]Message, error) {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+	for {
+		line, err := s.in.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			return decodeBlob(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *ManualSignaler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed != nil {
+		close(s.closed)
+		s.closed = nil
+	}
+	return nil
+}
+
+// Compresses msgs into a single line of text
+func encodeBlob(msgs []Message) (string, error) {
+	for i := range msgs {
+		msgs[i].Version = ProtocolVersion
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if err := json.NewEncoder(w).Encode(msgs); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Inverse of encodeBlob
+func decodeBlob(blob string) ([]Message, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(blob)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []Message
+	if err := json.NewDecoder(flate.NewReader(bytes.NewReader(compressed))).Decode(&msgs); err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("Empty blob")
+	}
+	return msgs, nil
+}
@@ -0,0 +1,85 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestManualSignaler(t *testing.T) {
+	// the pipes stand for the human copying the blobs
+	offerIn, answerOut := io.Pipe()
+	answerIn, offerOut := io.Pipe()
+	defer offerIn.Close()
+	defer answerIn.Close()
+	offerer, answerer := connectPairWith(t,
+		ConnectionSettings{Signaler: NewManualSignaler(true, offerIn, offerOut)},
+		ConnectionSettings{Signaler: NewManualSignaler(false, answerIn, answerOut)},
+	)
+
+	payload := []byte("no server")
+	offerer.Send(payload)
+	if recv := answerer.Recv(); !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s", payload, recv)
+	}
+	answerer.Send(payload)
+	if recv := offerer.Recv(); !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s", payload, recv)
+	}
+}
+
+func TestManualSignalerOrder(t *testing.T) {
+	var out bytes.Buffer
+	s := NewManualSignaler(false, strings.NewReader(""), &out)
+	ctx := context.Background()
+	if _, err := s.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	answer := Message{Type: MessageAnswer, SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0"}}
+	candidate := Message{Type: MessageCandidate, Candidate: &webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host"}}
+
+	// a candidate queued before the description is not a renegotiation
+	if err := s.Send(ctx, candidate); err != nil {
+		t.Fatalf("Cannot send candidate: %v", err)
+	}
+	if err := s.Send(ctx, answer); err != nil {
+		t.Fatalf("Cannot send answer after a candidate: %v", err)
+	}
+	if err := s.Send(ctx, answer); err == nil {
+		t.Errorf("Expected an error for a second answer")
+	}
+	if err := s.Send(ctx, Message{Type: MessageEndOfCandidates}); err != nil {
+		t.Fatalf("Cannot end candidates: %v", err)
+	}
+	msgs, err := decodeBlob(strings.TrimSpace(out.String()))
+	if err != nil || len(msgs) != 3 {
+		t.Errorf("Unexpected blob %+v, %v", msgs, err)
+	}
+}
+
+func TestBlob(t *testing.T) {
+	sent := []Message{
+		{Type: MessageOffer, SDP: &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0"}},
+		{Type: MessageCandidate, Candidate: &webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host"}},
+		{Type: MessageEndOfCandidates},
+	}
+	blob, err := encodeBlob(sent)
+	if err != nil {
+		t.Fatalf("Cannot encode blob: %v", err)
+	}
+	msgs, err := decodeBlob(blob)
+	if err != nil {
+		t.Fatalf("Cannot decode blob: %v", err)
+	}
+	if len(msgs) != len(sent) || msgs[0].SDP.SDP != "v=0" || msgs[2].Type != MessageEndOfCandidates {
+		t.Errorf("Decoded %+v", msgs)
+	}
+	if _, err := decodeBlob("not a blob"); err == nil {
+		t.Errorf("Decoding garbage should fail")
+	}
+}
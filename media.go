@@ -0,0 +1,123 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+)
+
+// Adds a local audio/video track to the peer connection.
+// Tracks added once the connection is up are negotiated again
+// automatically, otherwise use ConnectionSettings.Tracks with FromSettings.
+func (c *Connection) AddTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	sender, err := c.peer.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+	// RTCP must be read for the interceptors (NACK, reports) to work
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return sender, nil
+}
+
+// MIME types of the codecs which can be stored in IVF files
+var ivfCodecs = map[string]string{
+	"VP80": webrtc.MimeTypeVP8,
+	"VP90": webrtc.MimeTypeVP9,
+	"AV01": webrtc.MimeTypeAV1,
+}
+
+// Writes the frames of an IVF file (VP8, VP9 or AV1) to track,
+// one every frame duration of the file timebase.
+// Returns nil at the end of the file, ctx.Err() if ctx is done first.
+func StreamIVF(ctx context.Context, track *webrtc.TrackLocalStaticSample, r io.Reader) error {
+	ivf, header, err := ivfreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+	mime, ok := ivfCodecs[header.FourCC]
+	if !ok {
+		return errors.New("Unsupported IVF codec " + header.FourCC)
+	}
+	if !strings.EqualFold(mime, track.Codec().MimeType) {
+		return errors.New("IVF codec " + mime + " does not match track codec " + track.Codec().MimeType)
+	}
+	if header.TimebaseDenominator == 0 {
+		return errors.New("Invalid IVF timebase")
+	}
+
+	duration := time.Duration(header.TimebaseNumerator) * time.Second / time.Duration(header.TimebaseDenominator)
+	ticker := time.NewTicker(duration)
+	defer ticker.Stop()
+	for {
+		frame, _, err := ivf.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := track.WriteSample(media.Sample{Data: frame, Duration: duration}); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Writes the pages of an Ogg Opus file to track, paced by their
+// granule positions.
+// Returns nil at the end of the file, ctx.Err() if ctx is done first.
+func StreamOgg(ctx context.Context, track *webrtc.TrackLocalStaticSample, r io.Reader) error {
+	if !strings.EqualFold(track.Codec().MimeType, webrtc.MimeTypeOpus) {
+		return errors.New("Ogg files need an Opus track, not " + track.Codec().MimeType)
+	}
+	ogg, _, err := oggreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+
+	// Opus granule positions are always in 48 kHz samples
+	const sampleRate = 48000
+	var lastGranule uint64
+	next := time.Now()
+	for {
+		page, header, err := ogg.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		samples := header.GranulePosition - lastGranule
+		lastGranule = header.GranulePosition
+		duration := time.Duration(samples) * time.Second / sampleRate
+
+		if err := track.WriteSample(media.Sample{Data: page, Duration: duration}); err != nil {
+			return err
+		}
+		// a ticker cannot follow pages of different durations
+		next = next.Add(duration)
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
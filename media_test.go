@@ -0,0 +1,129 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// Builds an IVF file with the given number of VP8 frames at 50 fps
+func makeIVF(frames int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("DKIF")
+	binary.Write(&buf, binary.LittleEndian, uint16(0))  // version
+	binary.Write(&buf, binary.LittleEndian, uint16(32)) // header size
+	buf.WriteString("VP80")
+	binary.Write(&buf, binary.LittleEndian, uint16(64)) // width
+	binary.Write(&buf, binary.LittleEndian, uint16(64)) // height
+	binary.Write(&buf, binary.LittleEndian, uint32(50)) // timebase denominator
+	binary.Write(&buf, binary.LittleEndian, uint32(1))  // timebase numerator
+	binary.Write(&buf, binary.LittleEndian, uint32(frames))
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	for i := range frames {
+		frame := bytes.Repeat([]byte{byte(i)}, 100)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(frame)))
+		binary.Write(&buf, binary.LittleEndian, uint64(i))
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+// Builds an Ogg Opus file with the given number of 20 ms pages
+func makeOgg(t *testing.T, pages int) []byte {
+	var buf bytes.Buffer
+	w, err := oggwriter.NewWith(&buf, 48000, 2)
+	if err != nil {
+		t.Fatalf("Cannot create ogg writer: %v", err)
+	}
+	for i := range pages {
+		w.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{Timestamp: uint32(i * 960)},
+			Payload: []byte{0xfc, 0xff, 0xfe},
+		})
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestMediaTracks(t *testing.T) {
+	type peer struct {
+		settings ConnectionSettings
+		video    *webrtc.TrackLocalStaticSample
+		audio    *webrtc.TrackLocalStaticSample
+		received chan string
+	}
+	peers := make([]*peer, 2)
+	for i := range peers {
+		video, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+		if err != nil {
+			t.Fatalf("Cannot create video track: %v", err)
+		}
+		audio, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "stream")
+		if err != nil {
+			t.Fatalf("Cannot create audio track: %v", err)
+		}
+		received := make(chan string, 2)
+		peers[i] = &peer{
+			settings: ConnectionSettings{
+				Key: "media",
+				Tracks: []webrtc.TrackLocal{video, audio},
+				OnTrack: func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+					if _, _, err := track.ReadRTP(); err == nil {
+						received <- track.Codec().MimeType
+					}
+				},
+			},
+			video: video,
+			audio: audio,
+			received: received,
+		}
+	}
+	connectPairWith(t, peers[0].settings, peers[1].settings)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ivf, ogg := makeIVF(50), makeOgg(t, 50)
+	for _, p := range peers {
+		go func() {
+			err := StreamIVF(ctx, p.video, bytes.NewReader(ivf))
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("Cannot stream IVF: %v", err)
+			}
+		}()
+		go func() {
+			err := StreamOgg(ctx, p.audio, bytes.NewReader(ogg))
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("Cannot stream Ogg: %v", err)
+			}
+		}()
+	}
+
+	for i, p := range peers {
+		got := map[string]bool{}
+		for len(got) < 2 {
+			select {
+			case mime := <-p.received:
+				got[mime] = true
+			case <-ctx.Done():
+				t.Fatalf("Peer %d received only %v", i, got)
+			}
+		}
+		if !got[webrtc.MimeTypeVP8] || !got[webrtc.MimeTypeOpus] {
+			t.Errorf("Peer %d received %v", i, got)
+		}
+	}
+}
+
+func TestStreamCodecMismatch(t *testing.T) {
+	audio, _ := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "stream")
+	if err := StreamIVF(context.Background(), audio, bytes.NewReader(makeIVF(1))); err == nil {
+		t.Errorf("Streaming VP8 frames to an Opus track should fail")
+	}
+}
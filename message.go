@@ -0,0 +1,126 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Version of the signaling message schema
+const ProtocolVersion = 1
+
+type MessageType string
+
+const (
+	// SDP offer, in SDP
+	MessageOffer MessageType = "offer"
+	// SDP answer, in SDP
+	MessageAnswer MessageType = "answer"
+	// ICE candidate, in Candidate
+	MessageCandidate MessageType = "candidate"
+	// The sender has gathered all its candidates
+	MessageEndOfCandidates MessageType = "end-of-candidates"
+	// Request for an offer, with the kinds of the tracks to negotiate in Kinds
+	MessageNegotiate MessageType = "negotiate"
+	// Error of the sender (or of the server), in Error
+	MessageError MessageType = "error"
+)
+
+// A signaling message, sent as a JSON text message, e.g.
+//
+//	{"version":1,"type":"offer","sdp":{"type":"offer","sdp":"v=0..."}}
+//	{"version":1,"type":"candidate","candidate":{"candidate":"candidate:...","sdpMid":"0","sdpMLineIndex":0}}
+//	{"version":1,"type":"end-of-candidates"}
+//	{"version":1,"type":"negotiate","kinds":["video"]}
+//	{"version":1,"type":"error","error":"..."}
+//
+// Messages without version are in the legacy format, a map of
+// base64 strings with keys "type", "sdp" and "ice".
+type Message struct {
+	Version   int                        `json:"version"`
+	Type      MessageType                `json:"type"`
+	SDP       *webrtc.SessionDescription `json:"sdp,omitempty"`
+	Candidate *webrtc.ICECandidateInit   `json:"candidate,omitempty"`
+	Kinds     []string                   `json:"kinds,omitempty"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+// Returned when decoding a message of a type this version does not know
+var ErrUnknownMessage = errors.New("Unknown signaling message type")
+
+// Encodes msg in the current format, setting its version
+func EncodeMessage(msg Message) ([]byte, error) {
+	msg.Version = ProtocolVersion
+	return json.Marshal(msg)
+}
+
+// Decodes and validates a message, in either the current or the legacy format.
+// Messages of unknown type are returned along with ErrUnknownMessage.
+func DecodeMessage(p []byte) (Message, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return Message{}, err
+	}
+	var msg Message
+	if _, ok := fields["version"]; ok {
+		if err := json.Unmarshal(p, &msg); err != nil {
+			return Message{}, err
+		}
+		if msg.Version < 1 || msg.Version > ProtocolVersion {
+			return msg, errors.New("Unsupported signaling protocol version " + strconv.Itoa(msg.Version))
+		}
+	} else {
+		var err error
+		if msg, err = decodeLegacy(p); err != nil {
+			return Message{}, err
+		}
+	}
+	return msg, msg.validate()
+}
+
+// Decodes a message of the legacy format
+func decodeLegacy(p []byte) (Message, error) {
+	var legacy map[string][]byte
+	if err := json.Unmarshal(p, &legacy); err != nil {
+		return Message{}, err
+	}
+	msg := Message{Type: MessageType(legacy["type"])}
+	if sdp, ok := legacy["sdp"]; ok {
+		msg.SDP = &webrtc.SessionDescription{}
+		if err := json.Unmarshal(sdp, msg.SDP); err != nil {
+			return Message{}, err
+		}
+	}
+	if ice, ok := legacy["ice"]; ok {
+		msg.Candidate = &webrtc.ICECandidateInit{Candidate: string(ice)}
+	}
+	if kinds, ok := legacy["kinds"]; ok {
+		if err := json.Unmarshal(kinds, &msg.Kinds); err != nil {
+			return Message{}, err
+		}
+	}
+	return msg, nil
+}
+
+// Checks that the fields required by the message type are set
+func (msg *Message) validate() error {
+	switch msg.Type {
+	case MessageOffer, MessageAnswer:
+		if msg.SDP == nil {
+			return errors.New("Missing SDP in " + string(msg.Type) + " message")
+		}
+		if string(msg.Type) != msg.SDP.Type.String() {
+			return errors.New("SDP of type " + msg.SDP.Type.String() + " in " + string(msg.Type) + " message")
+		}
+	case MessageCandidate:
+		if msg.Candidate == nil {
+			return errors.New("Missing candidate in candidate message")
+		}
+	case MessageEndOfCandidates, MessageNegotiate, MessageError:
+	default:
+		return ErrUnknownMessage
+	}
+	return nil
+}
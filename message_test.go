@@ -0,0 +1,81 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	index := uint16(1)
+	mid := "1"
+	sent := Message{
+		Type: MessageCandidate,
+		Candidate: &webrtc.ICECandidateInit{
+			Candidate:     "candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host",
+			SDPMid:        &mid,
+			SDPMLineIndex: &index,
+		},
+	}
+	p, err := EncodeMessage(sent)
+	if err != nil {
+		t.Fatalf("Cannot encode: %v", err)
+	}
+	msg, err := DecodeMessage(p)
+	if err != nil {
+		t.Fatalf("Cannot decode %s: %v", p, err)
+	}
+	if msg.Version != ProtocolVersion || msg.Type != MessageCandidate {
+		t.Errorf("Decoded %+v", msg)
+	}
+	if *msg.Candidate.SDPMid != mid || *msg.Candidate.SDPMLineIndex != index {
+		t.Errorf("Candidate information lost: %+v", msg.Candidate)
+	}
+}
+
+func TestDecodeLegacyMessage(t *testing.T) {
+	sdp, _ := json.Marshal(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0"})
+	p, _ := json.Marshal(map[string][]byte{
+		"type": []byte("offer"),
+		"sdp":  sdp,
+	})
+	msg, err := DecodeMessage(p)
+	if err != nil {
+		t.Fatalf("Cannot decode legacy offer: %v", err)
+	}
+	if msg.Type != MessageOffer || msg.SDP.SDP != "v=0" {
+		t.Errorf("Decoded %+v", msg)
+	}
+
+	p, _ = json.Marshal(map[string][]byte{
+		"type": []byte("candidate"),
+		"ice":  []byte("candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host"),
+	})
+	msg, err = DecodeMessage(p)
+	if err != nil {
+		t.Fatalf("Cannot decode legacy candidate: %v", err)
+	}
+	if msg.Type != MessageCandidate || msg.Candidate.Candidate == "" {
+		t.Errorf("Decoded %+v", msg)
+	}
+}
+
+func TestDecodeInvalidMessage(t *testing.T) {
+	if _, err := DecodeMessage([]byte(`{"version":1,"type":"hello"}`)); !errors.Is(err, ErrUnknownMessage) {
+		t.Errorf("Expected ErrUnknownMessage, got %v", err)
+	}
+	invalid := []string{
+		`{"version":2,"type":"end-of-candidates"}`,
+		`{"version":1,"type":"offer"}`,
+		`{"version":1,"type":"answer","sdp":{"type":"offer","sdp":"v=0"}}`,
+		`{"version":1,"type":"candidate"}`,
+		`not json`,
+	}
+	for _, p := range invalid {
+		if _, err := DecodeMessage([]byte(p)); err == nil {
+			t.Errorf("%s should be invalid", p)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Time given to a renegotiation to send its message
+const renegotiationTimeout = 10 * time.Second
+
+// Renegotiation follows the WebRTC "perfect negotiation" pattern, with
+// the offerer of the signaling session as the impolite peer and the
+// answerer as the polite one: whenever pion reports that negotiation is
+// needed (e.g. after AddTrack) a new offer/answer exchange is started.
+//
+// pion implements rollback only as a signaling state change: it rejects
+// the SDP-less rollback description of the standard, and does not undo
+// the transceivers and mids set up by the withdrawn offer. So the polite
+// peer cannot cleanly withdraw its own offer on glare, and departs from
+// the pattern: it never offers after the first exchange, but sends a
+// "negotiate" message with the kinds of its unnegotiated tracks, and
+// the impolite peer offers on its behalf, adding a receiving
+// transceiver for each of them.
+// Offers colliding with a local one are still ignored by the impolite
+// peer, as the pattern requires.
+
+// Starts a new negotiation, unless the first one has not happened yet
+// (in that case the changes are part of it)
+func (c *Connection) renegotiate() {
+	c.mu.Lock()
+	ready := c.negotiated && !c.IsClosed
+	// the roles may change when reconnecting through the server
+	offer := c.Offer
+	c.mu.Unlock()
+	if !ready {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), renegotiationTimeout)
+	defer cancel()
+	var err error
+	if offer {
+		err = c.sendOffer(ctx, nil)
+	} else {
+		err = c.requestOffer(ctx)
+	}
+	if err != nil {
+		c.report(PhaseNegotiation, err)
+	}
+}
+
+// Asks the remote peer for an offer
+func (c *Connection) requestOffer(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a negotiation is in progress: once it completes pion
+	// checks again whether a new one is needed
+	if c.peer.SignalingState() != webrtc.SignalingStateStable {
+		return nil
+	}
+
+	var kinds []string
+	for _, t := range c.peer.GetTransceivers() {
+		if t.Mid() == "" && t.Sender() != nil && t.Sender().Track() != nil {
+			kinds = append(kinds, t.Kind().String())
+		}
+	}
+	return c.writeMessage(ctx, Message{Type: MessageNegotiate, Kinds: kinds})
+}
+
+// Handles an offer request of the remote peer
+func (c *Connection) requestedOffer(kinds []string) error {
+	c.mu.Lock()
+	offer := c.Offer
+	c.mu.Unlock()
+	if !offer {
+		return errors.New("Offer requested to the answering peer")
+	}
+	for _, kind := range kinds {
+		codecType := webrtc.NewRTPCodecType(kind)
+		if codecType == 0 {
+			return errors.New("Unknown media kind " + kind)
+		}
+		if _, err := c.peer.AddTransceiverFromKind(codecType, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.offerRequested = true
+	c.mu.Unlock()
+	go c.renegotiate()
+	return nil
+}
+
+// Sends the offer requested during the last negotiation, if any.
+// Called once the signaling state is stable again.
+func (c *Connection) offerIfRequested() {
+	c.mu.Lock()
+	requested := c.offerRequested
+	c.mu.Unlock()
+	if requested {
+		go c.renegotiate()
+	}
+}
+
+// Resolves offer collisions before applying a remote offer.
+// Returns true iff the offer must be ignored.
+func (c *Connection) acceptOffer() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.negotiated = true
+	collision := c.peer.SignalingState() != webrtc.SignalingStateStable
+	// the polite peer never has an offer of its own in flight
+	// once the first negotiation has happened
+	c.ignoreOffer = collision && c.Offer
+	if collision && !c.Offer {
+		return false, errors.New("Offer received in state " + c.peer.SignalingState().String())
+	}
+	return c.ignoreOffer, nil
+}
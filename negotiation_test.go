@@ -0,0 +1,77 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestRenegotiateChannel(t *testing.T) {
+	c1, c2 := connectPair(t, ConnectionSettings{Key: "renegotiate-channel"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the answerer opens the first channel of the session
+	ch2, err := c2.OpenChannel("late", nil)
+	if err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	ch1, err := c1.AcceptChannel(ctx, "late")
+	if err != nil {
+		t.Fatalf("Cannot accept channel: %v", err)
+	}
+	ch2.Send([]byte("hello"))
+	if msg := ch1.Recv(); string(msg) != "hello" {
+		t.Errorf("Expected hello, got %s", msg)
+	}
+}
+
+func TestRenegotiateGlare(t *testing.T) {
+	received := []chan string{make(chan string, 1), make(chan string, 1)}
+	settings := func(i int) ConnectionSettings {
+		return ConnectionSettings{
+			Key: "glare",
+			OnTrack: func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+				if _, _, err := track.ReadRTP(); err == nil {
+					received[i] <- track.Codec().MimeType
+				}
+			},
+		}
+	}
+	c1, c2 := connectPairWith(t, settings(0), settings(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ivf := makeIVF(500)
+	// both peers add a track at once, so that their offers collide
+	for _, c := range []*Connection{c1, c2} {
+		video, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "stream")
+		if err != nil {
+			t.Fatalf("Cannot create video track: %v", err)
+		}
+		if _, err := c.AddTrack(video); err != nil {
+			t.Fatalf("Cannot add track: %v", err)
+		}
+		go func() {
+			err := StreamIVF(ctx, video, bytes.NewReader(ivf))
+			if err != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("Cannot stream IVF: %v", err)
+			}
+		}()
+	}
+
+	for i, r := range received {
+		select {
+		case mime := <-r:
+			if mime != webrtc.MimeTypeVP8 {
+				t.Errorf("Peer %d received %s", i, mime)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Peer %d received no track", i)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package connection
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// net.Conn over a data channel of a Connection.
+// Each Write is sent as one message, or split into several when larger
+// than the channel accepts; Read returns the received messages as a
+// stream of bytes.
+// Closing a NetConn closes the underlying channel (or the whole
+// Connection for the default channel).
+type NetConn struct {
+	conn *Connection
+	in   chan []byte
+	out  chan []byte
+	done <-chan struct{}
+	closeFn func() error
+	// largest message accepted by the channel
+	maxSize func() int
+
+	// unread part of the last received message
+	pending []byte
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+
+	readDeadline  *deadline
+	writeDeadline *deadline
+}
+
+var _ net.Conn = (*NetConn)(nil)
+
+// Wraps the default data channel of c
+func NewNetConn(c *Connection) *NetConn {
+	return newNetConn(c, c.In, c.Out, c.stop, c.CloseAll, c.Settings.maxMessageSize)
+}
+
+// Wraps the named channel ch of c
+func NewChannelNetConn(c *Connection, ch *Channel) *NetConn {
+	return newNetConn(c, ch.In, ch.Out, ch.closed, ch.Close, ch.maxSize)
+}
+
+func newNetConn(
+	c *Connection,
+	in chan []byte,
+	out chan []byte,
+	done <-chan struct{},
+	closeFn func() error,
+	maxSize func() int,
+) *NetConn {
+	return &NetConn{
+		conn: c,
+		in: in,
+		out: out,
+		done: done,
+		closeFn: closeFn,
+		maxSize: maxSize,
+		readDeadline: newDeadline(),
+		writeDeadline: newDeadline(),
+	}
+}
+
+func (n *NetConn) Read(b []byte) (int, error) {
+	n.readMu.Lock()
+	defer n.readMu.Unlock()
+
+	for len(n.pending) == 0 {
+		select {
+		case msg, ok := <-n.out:
+			if !ok {
+				return 0, io.EOF
+			}
+			n.pending = msg
+		case <-n.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+	k := copy(b, n.pending)
+	n.pending = n.pending[k:]
+	return k, nil
+}
+
+func (n *NetConn) Write(b []byte) (int, error) {
+	n.writeMu.Lock()
+	defer n.writeMu.Unlock()
+
+	select {
+	case <-n.done:
+		return 0, net.ErrClosed
+	case <-n.writeDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	// the stream is split into messages the channel accepts
+	size := max(n.maxSize(), 1)
+	written := 0
+	for {
+		msg := make([]byte, min(len(b)-written, size))
+		copy(msg, b[written:])
+		select {
+		case n.in <- msg:
+		case <-n.done:
+			return written, net.ErrClosed
+		case <-n.writeDeadline.wait():
+			return written, os.ErrDeadlineExceeded
+		}
+		written += len(msg)
+		if written == len(b) {
+			return written, nil
+		}
+	}
+}
+
+func (n *NetConn) Close() error {
+	return n.closeFn()
+}
+
+// Local address of the selected ICE candidate pair
+func (n *NetConn) LocalAddr() net.Addr {
+	local, _ := n.conn.candidatePair()
+	return candidateAddr(local)
+}
+
+// Remote address of the selected ICE candidate pair
+func (n *NetConn) RemoteAddr() net.Addr {
+	_, remote := n.conn.candidatePair()
+	return candidateAddr(remote)
+}
+
+func (n *NetConn) SetDeadline(t time.Time) error {
+	n.readDeadline.set(t)
+	n.writeDeadline.set(t)
+	return nil
+}
+
+func (n *NetConn) SetReadDeadline(t time.Time) error {
+	n.readDeadline.set(t)
+	return nil
+}
+
+func (n *NetConn) SetWriteDeadline(t time.Time) error {
+	n.writeDeadline.set(t)
+	return nil
+}
+
+// Local and remote candidates of the selected ICE candidate pair,
+// nil if no pair has been selected
+func (c *Connection) candidatePair() (*webrtc.ICECandidate, *webrtc.ICECandidate) {
+	pair := c.selectedPair()
+	if pair == nil {
+		return nil, nil
+	}
+	return pair.Local, pair.Remote
+}
+
+// Selected ICE candidate pair, nil if none
+func (c *Connection) selectedPair() *webrtc.ICECandidatePair {
+	if c.peer == nil || c.peer.SCTP() == nil {
+		return nil
+	}
+	pair, err := c.peer.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return nil
+	}
+	return pair
+}
+
+// Address of an ICE candidate, an empty *net.UDPAddr if nil
+func candidateAddr(candidate *webrtc.ICECandidate) net.Addr {
+	if candidate == nil {
+		return &net.UDPAddr{}
+	}
+	ip := net.ParseIP(candidate.Address)
+	if candidate.Protocol == webrtc.ICEProtocolTCP {
+		return &net.TCPAddr{IP: ip, Port: int(candidate.Port)}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(candidate.Port)}
+}
+
+// Deadline of a NetConn: the channel returned by wait
+// is closed once the deadline has passed
+type deadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{expired: make(chan struct{})}
+}
+
+// Sets the deadline, the zero time removes it
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// the timer has fired, or is firing
+		<-d.expired
+	}
+	d.timer = nil
+
+	select {
+	case <-d.expired:
+		d.expired = make(chan struct{})
+	default:
+	}
+
+	if t.IsZero() {
+		return
+	}
+	wait := time.Until(t)
+	if wait <= 0 {
+		close(d.expired)
+		return
+	}
+	expired := d.expired
+	d.timer = time.AfterFunc(wait, func() { close(expired) })
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
@@ -0,0 +1,119 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+type gobMessage struct {
+	Name  string
+	Value int
+}
+
+func TestNetConn(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "netconn"})
+	var c1, c2 net.Conn = NewNetConn(offerer), NewNetConn(answerer)
+
+	// gob stream
+	go func() {
+		enc := gob.NewEncoder(c1)
+		for i := range 3 {
+			if err := enc.Encode(gobMessage{"msg", i}); err != nil {
+				t.Errorf("Cannot encode: %v", err)
+			}
+		}
+	}()
+	dec := gob.NewDecoder(c2)
+	for i := range 3 {
+		var m gobMessage
+		if err := dec.Decode(&m); err != nil {
+			t.Fatalf("Cannot decode: %v", err)
+		}
+		if m.Value != i {
+			t.Errorf("Expected %d, got %d", i, m.Value)
+		}
+	}
+
+	// partial reads through bufio
+	if _, err := c2.Write([]byte("first line\nsecond ")); err != nil {
+		t.Fatalf("Cannot write: %v", err)
+	}
+	c2.Write([]byte("line\n"))
+	r := bufio.NewReader(c1)
+	for _, expected := range []string{"first line\n", "second line\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil || line != expected {
+			t.Errorf("Expected %q, got %q (%v)", expected, line, err)
+		}
+	}
+
+	addr, ok := c1.LocalAddr().(*net.UDPAddr)
+	if !ok || addr.IP == nil || addr.Port == 0 {
+		t.Errorf("Unexpected local address %v", c1.LocalAddr())
+	}
+	if c1.RemoteAddr().String() != c2.LocalAddr().String() {
+		t.Errorf("Remote address %v differs from peer's local address %v", c1.RemoteAddr(), c2.LocalAddr())
+	}
+}
+
+func TestNetConnDeadline(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "deadline"})
+	c1, c2 := NewNetConn(offerer), NewNetConn(answerer)
+
+	c1.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	buf := make([]byte, 8)
+	_, err := c1.Read(buf)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Errorf("Deadline error should be a timeout")
+	}
+
+	// removing the deadline makes reads work again
+	c1.SetReadDeadline(time.Time{})
+	c2.Write([]byte("hi"))
+	if k, err := c1.Read(buf); err != nil || string(buf[:k]) != "hi" {
+		t.Errorf("Expected hi, got %q (%v)", buf[:k], err)
+	}
+
+	c2.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := c2.Write([]byte("late")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected a deadline error, got %v", err)
+	}
+
+	c2.Close()
+	c2.SetWriteDeadline(time.Time{})
+	if _, err := c2.Write([]byte("closed")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestNetConnLargeWrite(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "netconn-large", MaxMessageSize: 1024})
+	c1, c2 := NewNetConn(offerer), NewNetConn(answerer)
+
+	payload := make([]byte, 4096)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	if k, err := c1.Write(payload); err != nil || k != len(payload) {
+		t.Fatalf("Cannot write: %d, %v", k, err)
+	}
+	c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	recv := make([]byte, len(payload))
+	if _, err := io.ReadFull(c2, recv); err != nil {
+		t.Fatalf("Cannot read: %v", err)
+	}
+	if !bytes.Equal(recv, payload) {
+		t.Errorf("Received stream differs from the written one")
+	}
+}
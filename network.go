@@ -0,0 +1,103 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// Options of the ICE agent, for connections restricted to a LAN or
+// to fixed ports. Zero values keep the defaults of pion.
+//
+// Lab, host candidates only:
+//
+//	&NetworkSettings{NetworkTypes: []webrtc.NetworkType{webrtc.NetworkTypeUDP4}, MDNSMode: ice.MulticastDNSModeDisabled}
+//
+// Production, behind a single UDP port shared by all the connections:
+//
+//	mux, err := ice.NewMultiUDPMuxFromPort(5000)
+//	settings.Network = &NetworkSettings{UDPMux: mux, NAT1To1IPs: []string{"203.0.113.7"}}
+type NetworkSettings struct {
+	// Range of the local UDP ports used by ICE
+	PortMin uint16
+	PortMax uint16
+	// Mux carrying the ICE traffic of all the connections on one UDP port,
+	// overrides PortMin and PortMax. It is not closed with the connection
+	UDPMux ice.UDPMux
+	// Mux accepting ICE over TCP, required to gather TCP candidates
+	TCPMux ice.TCPMux
+	// Networks used to gather candidates, e.g. webrtc.NetworkTypeUDP4
+	NetworkTypes []webrtc.NetworkType
+	// Returns true for the names of the interfaces to use
+	InterfaceFilter func(string) bool
+	// Gather candidates on the loopback interface too,
+	// e.g. for peers on a machine without network
+	IncludeLoopback bool
+	// Public IPs mapped 1:1 to the local ones, advertised as
+	// NAT1To1CandidateType candidates (host if not set)
+	NAT1To1IPs           []string
+	NAT1To1CandidateType webrtc.ICECandidateType
+	// Whether mDNS candidates are gathered and accepted
+	MDNSMode ice.MulticastDNSMode
+	// Time without network activity before the connection is
+	// disconnected, then failed, and interval of the ICE keepalives
+	DisconnectedTimeout time.Duration
+	FailedTimeout       time.Duration
+	KeepAliveInterval   time.Duration
+}
+
+// ICE timeouts of pion
+const (
+	defaultDisconnectedTimeout = 5 * time.Second
+	defaultFailedTimeout       = 25 * time.Second
+	defaultKeepAliveInterval   = 2 * time.Second
+)
+
+// Applies the options to se
+func (n *NetworkSettings) apply(se *webrtc.SettingEngine) error {
+	if n.PortMin != 0 || n.PortMax != 0 {
+		if err := se.SetEphemeralUDPPortRange(n.PortMin, n.PortMax); err != nil {
+			return err
+		}
+	}
+	if n.UDPMux != nil {
+		se.SetICEUDPMux(n.UDPMux)
+	}
+	if n.TCPMux != nil {
+		se.SetICETCPMux(n.TCPMux)
+	}
+	if len(n.NetworkTypes) > 0 {
+		se.SetNetworkTypes(n.NetworkTypes)
+	}
+	if n.InterfaceFilter != nil {
+		se.SetInterfaceFilter(n.InterfaceFilter)
+	}
+	se.SetIncludeLoopbackCandidate(n.IncludeLoopback)
+	if len(n.NAT1To1IPs) > 0 {
+		typ := n.NAT1To1CandidateType
+		if typ == webrtc.ICECandidateTypeUnknown {
+			typ = webrtc.ICECandidateTypeHost
+		}
+		se.SetNAT1To1IPs(n.NAT1To1IPs, typ)
+	}
+	if n.MDNSMode != 0 {
+		se.SetICEMulticastDNSMode(n.MDNSMode)
+	}
+	if n.DisconnectedTimeout != 0 || n.FailedTimeout != 0 || n.KeepAliveInterval != 0 {
+		// pion sets all of them, zero meaning never
+		se.SetICETimeouts(
+			orDefault(n.DisconnectedTimeout, defaultDisconnectedTimeout),
+			orDefault(n.FailedTimeout, defaultFailedTimeout),
+			orDefault(n.KeepAliveInterval, defaultKeepAliveInterval),
+		)
+	}
+	return nil
+}
+
+func orDefault(d time.Duration, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
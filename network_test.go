@@ -0,0 +1,73 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+// Host candidates over IPv4 only, no internet required
+func labNetwork() *NetworkSettings {
+	return &NetworkSettings{
+		NetworkTypes: []webrtc.NetworkType{webrtc.NetworkTypeUDP4},
+		MDNSMode:     ice.MulticastDNSModeDisabled,
+	}
+}
+
+func TestNetworkPortRange(t *testing.T) {
+	network := labNetwork()
+	network.PortMin, network.PortMax = 41000, 41100
+	offerer, _ := connectPair(t, ConnectionSettings{Key: "network-range", Network: network})
+
+	pair := offerer.Stats().Pair
+	if pair == nil {
+		t.Fatalf("No selected candidate pair")
+	}
+	if pair.Local.Type != webrtc.ICECandidateTypeHost || pair.Local.Protocol != "udp" {
+		t.Errorf("Expected a udp host candidate, got %+v", pair.Local)
+	}
+	if pair.Local.Port < 41000 || pair.Local.Port > 41100 {
+		t.Errorf("Port %d out of range", pair.Local.Port)
+	}
+}
+
+func TestNetworkUDPMux(t *testing.T) {
+	const port = 41234
+	mux, err := ice.NewMultiUDPMuxFromPort(port, ice.UDPMuxFromPortWithNetworks(ice.NetworkTypeUDP4))
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer mux.Close()
+
+	// the two peers cannot share a mux: their candidates would have the same address
+	network := labNetwork()
+	network.UDPMux = mux
+	offerer, answerer := connectPairWith(t,
+		ConnectionSettings{Key: "network-mux", Network: network},
+		ConnectionSettings{Key: "network-mux", Network: labNetwork()},
+	)
+
+	muxed := offerer
+	if answerer.Settings.Network.UDPMux != nil {
+		muxed = answerer
+	}
+	pair := muxed.Stats().Pair
+	if pair == nil {
+		t.Fatalf("No selected candidate pair")
+	}
+	if pair.Local.Port != port {
+		t.Errorf("Expected port %d, got %d", port, pair.Local.Port)
+	}
+}
+
+func TestNetworkInvalid(t *testing.T) {
+	c := CreateConnection(&ConnectionSettings{
+		Key:        "network-invalid",
+		BufferSize: 1,
+		Network:    &NetworkSettings{PortMin: 2000, PortMax: 1000},
+	})
+	if err := c.MakePeerConnection(); err == nil {
+		t.Errorf("Expected an error for an invalid port range")
+	}
+}
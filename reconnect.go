@@ -0,0 +1,168 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Retry policy used to recover a connection whose peer connection
+// has been disconnected or has failed.
+// Each attempt restarts ICE over the signaling session, or first
+// connects again through the Signaler (the signaling server with the
+// same Key by default) if the session has been closed. The offerer of the current signaling
+// session drives the restart.
+// Messages queued in In, or sent but not yet acknowledged by the
+// remote peer, are kept and delivered once the connection is back.
+// Failed attempts are reported to Settings.OnError; when all of them
+// fail the connection is closed with ErrReconnectFailed.
+type ReconnectPolicy struct {
+	// Number of attempts before giving up
+	MaxAttempts int
+	// Wait before the first attempt, doubled after each failed attempt
+	Backoff time.Duration
+	// Upper bound for the wait between attempts
+	MaxBackoff time.Duration
+	// Time given to an attempt to bring the connection back
+	AttemptTimeout time.Duration
+}
+
+// Policy with 5 attempts, waiting from 1 to 10 seconds between them
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		MaxAttempts: 5,
+		Backoff: time.Second,
+		MaxBackoff: 10 * time.Second,
+		AttemptTimeout: 10 * time.Second,
+	}
+}
+
+// Wait before the given attempt (starting from 0)
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	wait := p.Backoff
+	for i := 0; i < attempt; i++ {
+		wait *= 2
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return wait
+}
+
+// Wakes up the goroutines waiting for a state change
+func (c *Connection) wakeState() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.stateWake)
+	c.stateWake = make(chan struct{})
+}
+
+// Starts the reconnection loop, unless disabled or already running.
+// Returns false iff reconnection is disabled
+func (c *Connection) startReconnect() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Settings.Reconnect == nil {
+		return false
+	}
+	if c.IsClosed || c.reconnecting {
+		return true
+	}
+	c.reconnecting = true
+	go c.reconnectLoop(c.Settings.Reconnect)
+	return true
+}
+
+func (c *Connection) reconnectLoop(policy *ReconnectPolicy) {
+	defer func() {
+		c.mu.Lock()
+		c.reconnecting = false
+		c.mu.Unlock()
+	}()
+
+	err := ErrPeerFailed
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(policy.backoff(attempt)):
+		case <-c.closed:
+			return
+		}
+		// ICE may have recovered on its own
+		if c.peer.ConnectionState() == webrtc.PeerConnectionStateConnected {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), policy.AttemptTimeout)
+		err = c.restart(ctx)
+		if err == nil {
+			err = c.waitConnected(ctx)
+		}
+		cancel()
+		if err == nil {
+			return
+		}
+		c.report(PhaseNegotiation, err)
+	}
+	c.fail(PhaseNegotiation, fmt.Errorf("%w: %w", ErrReconnectFailed, err))
+}
+
+// Restarts ICE, connecting again to the signaling server if needed.
+// Only the offerer sends the restart offer, the answerer replies
+// from ConsumeSignaling.
+func (c *Connection) restart(ctx context.Context) error {
+	if c.signalingClosed() {
+		if err := c.ConnectSignalingContext(ctx); err != nil {
+			return err
+		}
+		go c.consume()
+	}
+	c.mu.Lock()
+	offer := c.Offer
+	c.mu.Unlock()
+	if !offer {
+		return nil
+	}
+	return c.sendOffer(ctx, &webrtc.OfferOptions{ICERestart: true})
+}
+
+// True iff the current signaling session is not being read anymore
+func (c *Connection) signalingClosed() bool {
+	c.mu.Lock()
+	done := c.signalingDone
+	c.mu.Unlock()
+	if done == nil {
+		return true
+	}
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Blocks until the peer connection is connected
+func (c *Connection) waitConnected(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		wake := c.stateWake
+		c.mu.Unlock()
+
+		switch c.peer.ConnectionState() {
+		case webrtc.PeerConnectionStateConnected:
+			return nil
+		case webrtc.PeerConnectionStateClosed:
+			return errors.New("Peer connection closed")
+		}
+		select {
+		case <-wake:
+		case <-c.closed:
+			return errors.New("Connection closed")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
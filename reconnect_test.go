@@ -0,0 +1,236 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/transport/v4/vnet"
+	"github.com/pion/webrtc/v4"
+)
+
+var ufragRe = regexp.MustCompile(`a=ice-ufrag:(\S+)`)
+
+// ICE username fragment of the remote description
+func remoteUfrag(c *Connection) string {
+	desc := c.peer.CurrentRemoteDescription()
+	if desc == nil {
+		return ""
+	}
+	m := ufragRe.FindStringSubmatch(desc.SDP)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// Waits until both peers have applied the restarted ICE credentials,
+// then checks that data still flows
+func checkRestarted(t *testing.T, offerer *Connection, answerer *Connection, before [2]string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for remoteUfrag(offerer) == before[0] || remoteUfrag(answerer) == before[1] {
+		if time.Now().After(deadline) {
+			t.Fatalf("ICE was not restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, c := range []*Connection{offerer, answerer} {
+		if err := c.waitConnected(ctx); err != nil {
+			t.Fatalf("Not connected after restart: %v", err)
+		}
+	}
+	payload := []byte("again")
+	offerer.Send(payload)
+	if recv := answerer.Recv(); !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s", payload, recv)
+	}
+	answerer.Send(payload)
+	if recv := offerer.Recv(); !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s", payload, recv)
+	}
+}
+
+func TestICERestart(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "restart"})
+	before := [2]string{remoteUfrag(offerer), remoteUfrag(answerer)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := offerer.restart(ctx); err != nil {
+		t.Fatalf("Cannot restart ICE: %v", err)
+	}
+	checkRestarted(t, offerer, answerer, before)
+}
+
+func TestReconnectSignaling(t *testing.T) {
+	c1, c2 := connectPair(t, ConnectionSettings{Key: "rendezvous"})
+	before := [2]string{remoteUfrag(c1), remoteUfrag(c2)}
+
+	// the signaling server goes away
+	c1.signaler.Close()
+	c2.signaler.Close()
+	for !c1.signalingClosed() || !c2.signalingClosed() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- c1.restart(ctx) }()
+	if err := c2.restart(ctx); err != nil {
+		t.Fatalf("Cannot reconnect: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Cannot reconnect: %v", err)
+	}
+
+	// roles may have changed
+	if c2.Offer {
+		c1, c2 = c2, c1
+		before[0], before[1] = before[1], before[0]
+	}
+	checkRestarted(t, c1, c2, before)
+}
+
+// Connects two peers over lossyNetwork
+func connectLossy(t *testing.T, key string, policy *ReconnectPolicy) (*Connection, *Connection, *atomic.Bool) {
+	t.Helper()
+	apis, down := lossyNetwork(t)
+	var settings [2]ConnectionSettings
+	for i, api := range apis {
+		settings[i] = ConnectionSettings{
+			Key:       key,
+			Reconnect: policy,
+			API:       api,
+		}
+	}
+	c1, c2 := connectPairWith(t, settings[0], settings[1])
+	return c1, c2, down
+}
+
+// APIs of two peers on a virtual network whose packets are dropped
+// while down is set. ICE fails within a second without packets.
+// The peers cannot share an API, each one has its own virtual interface.
+func lossyNetwork(t *testing.T) ([2]*webrtc.API, *atomic.Bool) {
+	t.Helper()
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: NewLoggerFactory(slog.New(slog.DiscardHandler)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := new(atomic.Bool)
+	wan.AddChunkFilter(func(vnet.Chunk) bool { return !down.Load() })
+
+	var apis [2]*webrtc.API
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		nw, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{ip}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wan.AddNet(nw); err != nil {
+			t.Fatal(err)
+		}
+		se := webrtc.SettingEngine{}
+		se.SetNet(nw)
+		se.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+		se.SetICETimeouts(200*time.Millisecond, 500*time.Millisecond, 50*time.Millisecond)
+		// retransmit soon after the link is back
+		se.SetSCTPRTOMax(500 * time.Millisecond)
+		apis[i] = webrtc.NewAPI(webrtc.WithSettingEngine(se))
+	}
+	if err := wan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// registered first, so that it runs after the connections are closed
+	t.Cleanup(func() { wan.Stop() })
+	return apis, down
+}
+
+func TestReconnectAutomatic(t *testing.T) {
+	policy := &ReconnectPolicy{
+		MaxAttempts:    10,
+		Backoff:        100 * time.Millisecond,
+		MaxBackoff:     500 * time.Millisecond,
+		AttemptTimeout: 3 * time.Second,
+	}
+	c1, c2, down := connectLossy(t, "reconnect-automatic", policy)
+	events, cancel := c1.Subscribe(64)
+	defer cancel()
+
+	// the link and the signaling server go away
+	down.Store(true)
+	c1.signaler.Close()
+	c2.signaler.Close()
+	waitEvent(t, events, func(ev StateEvent) bool {
+		return ev.Kind == StatePeerConnection && ev.PeerConnection == webrtc.PeerConnectionStateFailed
+	})
+	payload := []byte("sent while down")
+	c1.Send(payload)
+	time.Sleep(300 * time.Millisecond)
+	down.Store(false)
+
+	ctx, cancelRecv := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelRecv()
+	recv, err := c2.RecvContext(ctx)
+	if err != nil {
+		t.Fatalf("Message sent while down not delivered: %v", err)
+	}
+	if !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s", payload, recv)
+	}
+	for _, c := range []*Connection{c1, c2} {
+		if err := c.waitConnected(ctx); err != nil {
+			t.Fatalf("Not reconnected: %v", err)
+		}
+		if c.Err() != nil {
+			t.Errorf("Connection should not be failed: %v", c.Err())
+		}
+	}
+	c2.Send(payload)
+	if recv, err := c1.RecvContext(ctx); err != nil || !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s, %v", payload, recv, err)
+	}
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	policy := &ReconnectPolicy{
+		MaxAttempts:    2,
+		Backoff:        50 * time.Millisecond,
+		AttemptTimeout: 500 * time.Millisecond,
+	}
+	c1, c2, down := connectLossy(t, "reconnect-give-up", policy)
+
+	down.Store(true)
+	for _, c := range []*Connection{c1, c2} {
+		select {
+		case <-c.Done():
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Connection not closed")
+		}
+		if !errors.Is(c.Err(), ErrReconnectFailed) {
+			t.Errorf("Expected ErrReconnectFailed, got %v", c.Err())
+		}
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	p := ReconnectPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, e := range expected {
+		if b := p.backoff(i); b != e {
+			t.Errorf("Attempt %d: expected %v, got %v", i, e, b)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// Role requested to the signaling server by a WebSocketSignaler
+type Role string
+
+const (
+	// The first peer of a key makes the offer
+	RoleAny Role = ""
+	// Waits for dialers and answers their offer, see Listen
+	RoleListen Role = "listen"
+	// Makes the offer to a listener, see Dial
+	RoleDial Role = "dial"
+)
+
+// Connects to the peer listening on settings.Key, as the offerer.
+// Waits for the listener until the server times out (ErrSignalingTimeout),
+// and fails with ErrRoleConflict if another dialer is already waiting.
+// settings.Signaler must be nil.
+func Dial(ctx context.Context, settings *ConnectionSettings) (*Connection, error) {
+	if settings.Signaler != nil {
+		return nil, errors.New("Dial needs a signaling server, not a Signaler")
+	}
+	s := *settings
+	s.Signaler = &WebSocketSignaler{URL: s.Signaling, Key: s.Key, Role: RoleDial}
+	return FromSettingsContext(ctx, &s)
+}
+
+// Accepts the peers dialing a key, one after the other
+type Listener struct {
+	settings  ConnectionSettings
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Listens on settings.Key. The server is only contacted by Accept, which
+// fails with ErrRoleConflict while another Listener of the key, from this
+// or another process, is waiting in Accept. settings.Signaler must be nil.
+//
+// Connections accepted by the listener reconnecting through the server
+// (see ReconnectPolicy) conflict with a pending Accept on the same key.
+func Listen(settings *ConnectionSettings) (*Listener, error) {
+	if settings.Signaler != nil {
+		return nil, errors.New("Listen needs a signaling server, not a Signaler")
+	}
+	if settings.BufferSize == 0 {
+		return nil, errors.New("Buffer size must be greater than 0")
+	}
+	return &Listener{settings: *settings, closed: make(chan struct{})}, nil
+}
+
+// Waits for the next peer dialing the key and returns the connection
+// with it, once its data channel is open.
+// Returns net.ErrClosed once the listener is closed.
+func (l *Listener) Accept(ctx context.Context) (*Connection, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		s := l.settings
+		s.Signaler = &WebSocketSignaler{URL: s.Signaling, Key: s.Key, Role: RoleListen}
+		c, err := FromSettingsContext(ctx, &s)
+		select {
+		case <-l.closed:
+			if err == nil {
+				c.CloseAll()
+			}
+			return nil, net.ErrClosed
+		default:
+		}
+		if errors.Is(err, ErrSignalingTimeout) && ctx.Err() == nil {
+			// nobody dialed in time, listen again
+			continue
+		}
+		return c, err
+	}
+}
+
+// Stops listening, interrupting Accept.
+// The accepted connections are left open.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
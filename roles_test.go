@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialListen(t *testing.T) {
+	settings := ConnectionSettings{Signaling: signalingURL, Key: "listen", BufferSize: 1}
+	l, err := Listen(&settings)
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer l.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	accepted := make(chan *Connection)
+	go func() {
+		for {
+			c, err := l.Accept(ctx)
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	// successive peers, the second one dialing after the listener timed out once
+	for i, delay := range []time.Duration{0, testSignalingTimeout + 500*time.Millisecond} {
+		time.Sleep(delay)
+		dialer, err := Dial(ctx, &settings)
+		if err != nil {
+			t.Fatalf("Peer %d cannot dial: %v", i, err)
+		}
+		listener, ok := <-accepted
+		if !ok {
+			t.Fatalf("Peer %d not accepted", i)
+		}
+		if !dialer.Offer || listener.Offer {
+			t.Errorf("Dialer should offer, listener should answer")
+		}
+		dialer.Send([]byte("hello"))
+		if msg := listener.Recv(); string(msg) != "hello" {
+			t.Errorf("Expected hello, got %q", msg)
+		}
+		dialer.CloseAll()
+		listener.CloseAll()
+	}
+}
+
+func TestRoleConflict(t *testing.T) {
+	settings := ConnectionSettings{Signaling: signalingURL, Key: "conflict", BufferSize: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the first dialer waits for a listener
+	first := make(chan error, 1)
+	go func() {
+		c, err := Dial(ctx, &settings)
+		if err == nil {
+			c.CloseAll()
+		}
+		first <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if _, err := Dial(ctx, &settings); !errors.Is(err, ErrRoleConflict) {
+		t.Errorf("Expected ErrRoleConflict, got %v", err)
+	}
+	if err := <-first; !errors.Is(err, ErrSignalingTimeout) {
+		t.Errorf("Expected ErrSignalingTimeout without listener, got %v", err)
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := Listen(&ConnectionSettings{Signaling: signalingURL, Key: "listener-close", BufferSize: 1})
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { l.Close() })
+	if _, err := l.Accept(context.Background()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	connection "github.com/leogem2003/directchan"
+)
+
+// Options of the server, read from a JSON or TOML file and from the
+// environment variables DIRECTCHAN_SERVER_ADDR, DIRECTCHAN_SERVER_TIMEOUT
+// and DIRECTCHAN_SERVER_LOG_LEVEL
+type Config struct {
+	// Address to listen on
+	Addr string `json:"addr" toml:"addr" env:"SERVER_ADDR"`
+	// Time an offerer waits for its answerer
+	Timeout  connection.Duration `json:"timeout" toml:"timeout" env:"SERVER_TIMEOUT"`
+	LogLevel string              `json:"log_level" toml:"log_level" env:"SERVER_LOG_LEVEL"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Addr:     "0.0.0.0:8080",
+		Timeout:  connection.Duration(TIMEOUT),
+		LogLevel: "info",
+	}
+}
+
+// Reads the configuration from path (if not empty) and from the environment
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		if err := connection.DecodeConfigFile(path, config); err != nil {
+			return nil, err
+		}
+	}
+	if err := connection.ApplyEnv(config); err != nil {
+		return nil, err
+	}
+	return config, config.Validate()
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("timeout must be positive"))
+	}
+	if _, err := c.level(); err != nil {
+		errs = append(errs, errors.New("invalid log_level "+c.LogLevel))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) level() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+func (c *Config) timeout() time.Duration {
+	return time.Duration(c.Timeout)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.toml")
+	if err := os.WriteFile(path, []byte("addr = \":9000\"\ntimeout = \"30s\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DIRECTCHAN_SERVER_LOG_LEVEL", "debug")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Cannot load config: %v", err)
+	}
+	if config.Addr != ":9000" || config.timeout() != 30*time.Second || config.LogLevel != "debug" {
+		t.Errorf("Unexpected config %+v", config)
+	}
+
+	t.Setenv("DIRECTCHAN_SERVER_TIMEOUT", "0s")
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf("Expected an error for a zero timeout")
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	connection "github.com/leogem2003/directchan"
 )
 
+// Default time an offerer waits for its answerer
 const TIMEOUT = 10 * time.Second
 
 var Upgrader = websocket.Upgrader {
@@ -19,58 +23,113 @@ var Upgrader = websocket.Upgrader {
 }
 
 
+// Roles a client can request with the role query parameter ("/?role=listen").
+// Without it the first client of a key makes the offer.
+const (
+	RoleListen = "listen" // waits for dialers and answers them
+	RoleDial   = "dial"   // makes the offer to a listener
+)
+
+// Role message of the clients requesting role, "" for any
+func roleMessage(role string) string {
+	switch role {
+	case RoleListen:
+		return "ANSWER"
+	case RoleDial:
+		return "OFFER"
+	}
+	return ""
+}
+
+// The other role message
+func otherRole(msg string) string {
+	if msg == "OFFER" {
+		return "ANSWER"
+	}
+	return "OFFER"
+}
+
 type ConnPair struct {
-	offerer  *websocket.Conn
-	answerer *websocket.Conn
+	// first client of the key, waiting for the second
+	first  *websocket.Conn
+	second *websocket.Conn
 }
 
 type ConnHandler struct {
 	tmp  map[string]*CleanGuard
 	tmpLock   sync.Mutex
+	Logger *slog.Logger // nil means slog.Default()
+	Timeout time.Duration // zero means TIMEOUT
+}
+
+// Logger of the handler
+func (h *ConnHandler) logger() *slog.Logger {
+	if h.Logger == nil {
+		return slog.Default()
+	}
+	return h.Logger
+}
+
+// Logger of the handler, with the hash of key
+func (h *ConnHandler) log(key string) *slog.Logger {
+	return h.logger().With("key", connection.KeyHash(key))
 }
 
 type CleanGuard struct {
 	pair *ConnPair
 	stop chan bool
+	// role message sent to the first client
+	role string
 }
 
 
-func (h *ConnHandler) ServeOffer(conn *websocket.Conn, key string) {
+// Registers the first client of key, sending it role ("OFFER" or "ANSWER"),
+// and waits for the second one until timeout
+func (h *ConnHandler) ServeFirst(conn *websocket.Conn, key string, role string) {
 	stop := make(chan bool, 1)
-	pair := ConnPair{offerer: conn, answerer: nil}
-	guard := CleanGuard{pair: &pair, stop: stop}
+	pair := ConnPair{first: conn, second: nil}
+	guard := CleanGuard{pair: &pair, stop: stop, role: role}
 	h.tmp[key] = &guard
 	h.tmpLock.Unlock() // Instantiated guard, can do answer
 
-	if err := conn.WriteMessage(websocket.TextMessage, []byte("OFFER")); err != nil {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(role)); err != nil {
+		h.log(key).Warn("cannot send role", "role", role, "error", err)
 		conn.Close()
 		return
 	}
+	h.log(key).Info("waiting for peer", "role", role)
 
 	select {
 	case <-stop:
 		break
-	case <-time.After(TIMEOUT):
-		conn.WriteMessage(websocket.TextMessage, []byte("Fatal: timeout"))
+	case <-time.After(h.timeout()):
+		writeError(h.log(key), conn, "timeout")
 		conn.Close()
-		log.Println("timeout expired for key ", key)
+		h.log(key).Info("timeout expired", "role", role)
 
 		h.tmpLock.Lock()
-		h.tmp[key] = nil 
+		if h.tmp[key] == &guard {
+			h.tmp[key] = nil
+		}
 		h.tmpLock.Unlock()
 	}
 }
 
 
-func (h *ConnHandler) ServeAnswer(conn *websocket.Conn, key string) {
-	pair := h.tmp[key].pair
-	h.tmp[key].stop <- true
+// Pairs the second client of key with the first one,
+// giving it the other role
+func (h *ConnHandler) ServeSecond(conn *websocket.Conn, key string) {
+	guard := h.tmp[key]
+	pair := guard.pair
+	guard.stop <- true
 	h.tmp[key] = nil
 	h.tmpLock.Unlock()
 
-	pair.answerer = conn
-	conn.WriteMessage(websocket.TextMessage, []byte("ANSWER"))
-	pair.offerer.WriteMessage(websocket.TextMessage, []byte("Ready"))
+	pair.second = conn
+	role := otherRole(guard.role)
+	h.log(key).Info("pair ready", "role", role)
+	conn.WriteMessage(websocket.TextMessage, []byte(role))
+	pair.first.WriteMessage(websocket.TextMessage, []byte("Ready"))
 	conn.WriteMessage(websocket.TextMessage, []byte("Ready"))
 	// Starts signaling exchange
 	relay := func(c1 *websocket.Conn, c2 *websocket.Conn) {
@@ -93,40 +152,102 @@ func (h *ConnHandler) ServeAnswer(conn *websocket.Conn, key string) {
 		c1.Close()
 		c2.Close()
 	}
-	go relay(pair.answerer, pair.offerer)
-	go relay(pair.offerer, pair.answerer)
+	go relay(pair.second, pair.first)
+	go relay(pair.first, pair.second)
+}
+
+func (h *ConnHandler) timeout() time.Duration {
+	if h.Timeout == 0 {
+		return TIMEOUT
+	}
+	return h.Timeout
+}
+
+// Sends an error signaling message, logging to logger if it cannot
+func writeError(logger *slog.Logger, conn *websocket.Conn, reason string) {
+	msg, err := connection.EncodeMessage(connection.Message{Type: connection.MessageError, Error: reason})
+	if err != nil {
+		logger.Error("cannot encode error message", "error", err)
+		return
+	}
+	conn.WriteMessage(websocket.TextMessage, msg)
 }
 
 func (h *ConnHandler) Connect(w http.ResponseWriter, r *http.Request) {
 	conn, err := Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		h.logger().Warn("cannot upgrade", "error", err)
 		return
 	}
 	_, msg, err := conn.ReadMessage()
-	log.Printf("Received request for: %s\n", msg)
+	if err != nil {
+		h.logger().Warn("cannot read key", "error", err)
+		conn.Close()
+		return
+	}
 	key := string(msg)
+	role := r.URL.Query().Get("role")
+	h.log(key).Debug("received request", "role", role)
+	if role != "" && roleMessage(role) == "" {
+		writeError(h.log(key), conn, "unknown role "+role)
+		conn.Close()
+		return
+	}
+	want := roleMessage(role)
 
 	h.tmpLock.Lock() // IMPORTANT unlock inside called functions
 	guard := h.tmp[key]
 	if guard == nil {
-		h.ServeOffer(conn, key)
+		if want == "" {
+			want = "OFFER"
+		}
+		h.ServeFirst(conn, key, want)
 	} else {
-		if guard.pair.answerer == nil {
-			h.ServeAnswer(conn, key)	
+		if guard.pair.second == nil && want != "" && want == guard.role {
+			h.tmpLock.Unlock()
+			reason := "role conflict: key already has a listener"
+			if want == "OFFER" {
+				reason = "role conflict: key already has a waiting offerer"
+			}
+			h.log(key).Warn("role conflict", "role", role)
+			writeError(h.log(key), conn, reason)
+			conn.Close()
+		} else if guard.pair.second == nil {
+			h.ServeSecond(conn, key)	
 		} else {
 			h.tmpLock.Unlock()	
-			conn.WriteMessage(websocket.TextMessage, []byte("KO: slot already allocated"))
+			h.log(key).Warn("slot already allocated")
+			writeError(h.log(key), conn, "slot already allocated")
 			conn.Close()
 		}
 	}
 }
 
 func main() {
+	configPath := flag.String("config", "", "JSON or TOML configuration file")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server [-config file] [port]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if flag.NArg() > 0 {
+		config.Addr = "0.0.0.0:" + flag.Arg(0)
+	}
+
+	level, _ := config.level()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 	handler := new(ConnHandler)
 	handler.tmp = make(map[string]*CleanGuard)
+	handler.Logger = logger
+	handler.Timeout = config.timeout()
 	http.HandleFunc("/", handler.Connect)
-	port := os.Args[1]
-	log.Println("Serving on port ", port)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+port, nil))
+	logger.Info("serving", "addr", config.Addr)
+	err = http.ListenAndServe(config.Addr, nil)
+	logger.Error("server stopped", "error", err)
+	os.Exit(1)
 }
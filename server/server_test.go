@@ -1,17 +1,26 @@
 package main
 import (
+	"context"
+	"errors"
 	"testing"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"time"
 	ws "github.com/gorilla/websocket"
+	connection "github.com/leogem2003/directchan"
 )
 
-func startServer() {
+func startServer(ln net.Listener) {
 	handler := new(ConnHandler)
 	handler.tmp = make(map[string]*CleanGuard)
 	http.HandleFunc("/", handler.Connect)
-	log.Fatal(http.ListenAndServe("0.0.0.0:8080", nil))
+	log.Fatal(http.Serve(ln, nil))
 }
 
 func TestConnect(t *testing.T) {
@@ -98,7 +107,193 @@ func TestConnect(t *testing.T) {
 }
 
 func TestMain(m *testing.M) {
-	go startServer()
+	ln, err := net.Listen("tcp", "0.0.0.0:8080")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go startServer(ln)
 	code := m.Run()
 	os.Exit(code)
 }
+
+// Dials the server with the given role and sends key
+func dialRole(t *testing.T, key string, role string) *ws.Conn {
+	t.Helper()
+	conn, _, err := ws.DefaultDialer.Dial("ws://localhost:8080/?role="+role, nil)
+	if err != nil {
+		t.Fatalf("Cannot dial: %v", err)
+	}
+	if err := conn.WriteMessage(ws.TextMessage, []byte(key)); err != nil {
+		t.Fatalf("Cannot send key: %v", err)
+	}
+	return conn
+}
+
+// Reads a message and checks that it contains want
+func expect(t *testing.T, conn *ws.Conn, want string) {
+	t.Helper()
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Expected %s, got %v", want, err)
+	}
+	if !strings.Contains(string(msg), want) {
+		t.Errorf("Expected %s, got %s", want, msg)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	listener := dialRole(t, "roles", RoleListen)
+	defer listener.Close()
+	expect(t, listener, "ANSWER")
+
+	other := dialRole(t, "roles", RoleListen)
+	defer other.Close()
+	expect(t, other, "role conflict")
+
+	dialer := dialRole(t, "roles", RoleDial)
+	defer dialer.Close()
+	expect(t, dialer, "OFFER")
+	expect(t, listener, "Ready")
+	expect(t, dialer, "Ready")
+
+	unknown := dialRole(t, "roles", "host")
+	defer unknown.Close()
+	expect(t, unknown, "unknown role")
+}
+
+// Serves a new handler with the given timeout, returning its ws URL
+func serveHandler(t *testing.T, timeout time.Duration) string {
+	handler := &ConnHandler{tmp: make(map[string]*CleanGuard), Timeout: timeout}
+	srv := httptest.NewServer(http.HandlerFunc(handler.Connect))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// Dial, Listen and the WebSocketSignaler against this server
+func TestDialListenEndToEnd(t *testing.T) {
+	const timeout = time.Second
+	settings := connection.ConnectionSettings{Signaling: serveHandler(t, timeout), Key: "e2e", BufferSize: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	l, err := connection.Listen(&settings)
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer l.Close()
+	accepted := make(chan *connection.Connection, 1)
+	errs := make(chan error, 1)
+	go func() {
+		c, err := l.Accept(ctx)
+		if err != nil {
+			errs <- err
+			return
+		}
+		accepted <- c
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	other, _ := connection.Listen(&settings)
+	if _, err := other.Accept(ctx); !errors.Is(err, connection.ErrRoleConflict) {
+		t.Errorf("Expected ErrRoleConflict, got %v", err)
+	}
+
+	// the listener has timed out once when the dialer comes
+	time.Sleep(timeout)
+	dialer, err := connection.Dial(ctx, &settings)
+	if err != nil {
+		t.Fatalf("Cannot dial: %v", err)
+	}
+	defer dialer.CloseAll()
+	var listener *connection.Connection
+	select {
+	case listener = <-accepted:
+	case err := <-errs:
+		t.Fatalf("Cannot accept: %v", err)
+	}
+	defer listener.CloseAll()
+	if !dialer.Offer || listener.Offer {
+		t.Errorf("Dialer should offer, listener should answer")
+	}
+	dialer.Send([]byte("hello"))
+	if msg := listener.Recv(); string(msg) != "hello" {
+		t.Errorf("Expected hello, got %q", msg)
+	}
+}
+
+func TestDialTimeoutEndToEnd(t *testing.T) {
+	settings := connection.ConnectionSettings{
+		Signaling: serveHandler(t, 200*time.Millisecond),
+		Key: "e2e-alone",
+		BufferSize: 1,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := connection.Dial(ctx, &settings); !errors.Is(err, connection.ErrSignalingTimeout) {
+		t.Errorf("Expected ErrSignalingTimeout, got %v", err)
+	}
+}
+
+// Buffer of log lines, safe for concurrent use
+type logBuffer struct {
+	lines []string
+	mu sync.Mutex
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines = append(b.lines, string(p))
+	return len(p), nil
+}
+
+// Waits for a line containing msg
+func (b *logBuffer) wait(t *testing.T, msg string) string {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		b.mu.Lock()
+		for _, line := range b.lines {
+			if strings.Contains(line, msg) {
+				b.mu.Unlock()
+				return line
+			}
+		}
+		b.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Log %q not written", msg)
+	return ""
+}
+
+func TestLogKey(t *testing.T) {
+	logs := new(logBuffer)
+	handler := &ConnHandler{
+		tmp: make(map[string]*CleanGuard),
+		Logger: slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler.Connect))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// closed before sending the key
+	conn, _, err := ws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Cannot dial: %v", err)
+	}
+	conn.Close()
+	if line := logs.wait(t, "cannot read key"); strings.Contains(line, "key=") {
+		t.Errorf("Key logged before being read: %s", line)
+	}
+
+	// errors are logged through the handler with the key
+	conn, _, err = ws.DefaultDialer.Dial(url+"?role=bogus", nil)
+	if err != nil {
+		t.Fatalf("Cannot dial: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteMessage(ws.TextMessage, []byte("log-key"))
+	conn.ReadMessage()
+	if line := logs.wait(t, "received request"); !strings.Contains(line, "key="+connection.KeyHash("log-key")) {
+		t.Errorf("Missing key hash: %s", line)
+	}
+}
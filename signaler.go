@@ -0,0 +1,156 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Transport of the signaling messages between the two peers.
+// Connect finds the remote peer and decides the roles, then messages
+// are exchanged with Send and Recv until Close.
+// Send and Recv may be called concurrently with each other,
+// but not with themselves.
+type Signaler interface {
+	// Blocks until the remote peer is reachable, or ctx is done.
+	// Returns true iff the local peer must make the offer.
+	// Connect is called again to start a new session after Close,
+	// or after the session has been closed remotely.
+	Connect(ctx context.Context) (bool, error)
+	// Sends a message to the remote peer, giving up once ctx is done
+	Send(ctx context.Context, msg Message) error
+	// Blocks until a message is received. Messages of unknown type
+	// are returned along with ErrUnknownMessage.
+	Recv() (Message, error)
+	// Closes the current session, unblocking Recv
+	Close() error
+}
+
+// Signaler connected to another MemorySignaler in the same process,
+// mainly for tests
+type MemorySignaler struct {
+	hub   *memoryHub
+	offer bool
+
+	link *memoryLink
+	mu   sync.Mutex
+}
+
+var _ Signaler = (*MemorySignaler)(nil)
+
+// Rendezvous point of a pair of MemorySignalers
+type memoryHub struct {
+	// session waiting for the other side
+	pending *memoryLink
+	mu      sync.Mutex
+}
+
+// A session between the two sides of a pair
+type memoryLink struct {
+	// messages towards the offerer and the answerer
+	toOfferer  chan Message
+	toAnswerer chan Message
+	// closed once both sides have connected
+	ready chan struct{}
+	// closed by Close on either side
+	closed    chan struct{}
+	closeOnce sync.Once
+	// side which created the session
+	creator *MemorySignaler
+}
+
+// Returns two connected signalers, the first one is the offerer
+func NewMemorySignalerPair() (*MemorySignaler, *MemorySignaler) {
+	hub := &memoryHub{}
+	return &MemorySignaler{hub: hub, offer: true}, &MemorySignaler{hub: hub, offer: false}
+}
+
+func (s *MemorySignaler) Connect(ctx context.Context) (bool, error) {
+	s.Close()
+
+	s.hub.mu.Lock()
+	link := s.hub.pending
+	if link == nil || link.creator == s {
+		link = &memoryLink{
+			toOfferer:  make(chan Message, 64),
+			toAnswerer: make(chan Message, 64),
+			ready:      make(chan struct{}),
+			closed:     make(chan struct{}),
+			creator:    s,
+		}
+		s.hub.pending = link
+	} else {
+		s.hub.pending = nil
+		close(link.ready)
+	}
+	s.hub.mu.Unlock()
+
+	select {
+	case <-link.ready:
+	case <-ctx.Done():
+		s.hub.mu.Lock()
+		if s.hub.pending == link {
+			s.hub.pending = nil
+		}
+		s.hub.mu.Unlock()
+		return s.offer, ctx.Err()
+	}
+
+	s.mu.Lock()
+	s.link = link
+	s.mu.Unlock()
+	return s.offer, nil
+}
+
+// Current session and its outgoing and incoming queues
+func (s *MemorySignaler) queues() (*memoryLink, chan Message, chan Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.link == nil {
+		return nil, nil, nil
+	}
+	if s.offer {
+		return s.link, s.link.toAnswerer, s.link.toOfferer
+	}
+	return s.link, s.link.toOfferer, s.link.toAnswerer
+}
+
+func (s *MemorySignaler) Send(ctx context.Context, msg Message) error {
+	link, out, _ := s.queues()
+	if link == nil {
+		return net.ErrClosed
+	}
+	msg.Version = ProtocolVersion
+	select {
+	case out <- msg:
+		return nil
+	case <-link.closed:
+		return net.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *MemorySignaler) Recv() (Message, error) {
+	link, _, in := s.queues()
+	if link == nil {
+		return Message{}, net.ErrClosed
+	}
+	select {
+	case msg := <-in:
+		return msg, msg.validate()
+	case <-link.closed:
+		return Message{}, net.ErrClosed
+	}
+}
+
+func (s *MemorySignaler) Close() error {
+	s.mu.Lock()
+	link := s.link
+	s.link = nil
+	s.mu.Unlock()
+	if link != nil {
+		link.closeOnce.Do(func() { close(link.closed) })
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package connection
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemorySignaler(t *testing.T) {
+	s1, s2 := NewMemorySignalerPair()
+	offerer, answerer := connectPairWith(t,
+		ConnectionSettings{Signaler: s1},
+		ConnectionSettings{Signaler: s2},
+	)
+	if offerer.signaler != s1 || answerer.signaler != s2 {
+		t.Fatalf("The first signaler of the pair should be the offerer")
+	}
+
+	payload := []byte("in memory")
+	offerer.Send(payload)
+	if recv := answerer.Recv(); !slices.Equal(recv, payload) {
+		t.Errorf("Expected %s, got %s", payload, recv)
+	}
+
+	// a new session can be started after the current one is closed
+	before := [2]string{remoteUfrag(offerer), remoteUfrag(answerer)}
+	s1.Close()
+	for !offerer.signalingClosed() || !answerer.signalingClosed() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- answerer.restart(ctx) }()
+	if err := offerer.restart(ctx); err != nil {
+		t.Fatalf("Cannot reconnect: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Cannot reconnect: %v", err)
+	}
+	checkRestarted(t, offerer, answerer, before)
+}
+
+func TestMemorySignalerCancel(t *testing.T) {
+	s1, _ := NewMemorySignalerPair()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s1.Connect(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
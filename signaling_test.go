@@ -0,0 +1,202 @@
+package connection
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// Address of the in-process signaling server used by the tests
+var signalingURL string
+
+// Minimal replica of the pairing protocol implemented in server/main.go:
+// the first client of a key is the offerer, unless it has requested a role,
+// the second one takes the other role, then messages are relayed between
+// the two. Waiting clients time out after testSignalingTimeout.
+// The library is tested against the real server in server/server_test.go.
+type testSignaling struct {
+	upgrader ws.Upgrader
+	waiting  map[string]*testWaiting
+	mu       sync.Mutex
+}
+
+// Client waiting for its peer
+type testWaiting struct {
+	conn *ws.Conn
+	// role message sent to the client
+	role  string
+	timer *time.Timer
+}
+
+const testSignalingTimeout = 2 * time.Second
+
+func newTestSignaling() *httptest.Server {
+	return httptest.NewServer(&testSignaling{waiting: make(map[string]*testWaiting)})
+}
+
+// OFFER or ANSWER for the roles of Dial and Listen
+func testRole(role string) string {
+	switch Role(role) {
+	case RoleListen:
+		return "ANSWER"
+	case RoleDial:
+		return "OFFER"
+	}
+	return ""
+}
+
+// Sends an error message and closes conn
+func testReject(conn *ws.Conn, reason string) {
+	msg, _ := EncodeMessage(Message{Type: MessageError, Error: reason})
+	conn.WriteMessage(ws.TextMessage, msg)
+	conn.Close()
+}
+
+func (s *testSignaling) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	key := string(msg)
+	want := testRole(r.URL.Query().Get("role"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := s.waiting[key]
+	if first == nil {
+		if want == "" {
+			want = "OFFER"
+		}
+		waiting := &testWaiting{conn: conn, role: want}
+		waiting.timer = time.AfterFunc(testSignalingTimeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.waiting[key] == waiting {
+				delete(s.waiting, key)
+				testReject(conn, "timeout")
+			}
+		})
+		s.waiting[key] = waiting
+		conn.WriteMessage(ws.TextMessage, []byte(want))
+		return
+	}
+	if want == first.role {
+		testReject(conn, "role conflict")
+		return
+	}
+	first.timer.Stop()
+	delete(s.waiting, key)
+
+	role := "ANSWER"
+	if first.role == "ANSWER" {
+		role = "OFFER"
+	}
+	conn.WriteMessage(ws.TextMessage, []byte(role))
+	first.conn.WriteMessage(ws.TextMessage, []byte("Ready"))
+	conn.WriteMessage(ws.TextMessage, []byte("Ready"))
+	reorder := strings.HasPrefix(key, "reorder")
+	go testRelay(first.conn, conn, reorder)
+	go testRelay(conn, first.conn, reorder)
+}
+
+// Forwards the messages of from to to.
+// If reorder is set offers and answers are delayed, so that
+// the candidates following them arrive first.
+func testRelay(from *ws.Conn, to *ws.Conn, reorder bool) {
+	defer from.Close()
+	defer to.Close()
+	var mu sync.Mutex
+	for {
+		t, p, err := from.ReadMessage()
+		if err != nil {
+			return
+		}
+		if reorder && isDescription(p) {
+			time.AfterFunc(200*time.Millisecond, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				to.WriteMessage(t, p)
+			})
+			continue
+		}
+		mu.Lock()
+		err = to.WriteMessage(t, p)
+		mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// True iff p is an offer or an answer
+func isDescription(p []byte) bool {
+	msg, err := DecodeMessage(p)
+	return err == nil && (msg.Type == MessageOffer || msg.Type == MessageAnswer)
+}
+
+func TestMain(m *testing.M) {
+	srv := newTestSignaling()
+	signalingURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+// Opens two connections with the given settings and returns them
+// as (offerer, answerer), once both data channels are open.
+// The connections are closed at the end of the test.
+func connectPair(t *testing.T, settings ConnectionSettings) (*Connection, *Connection) {
+	t.Helper()
+	return connectPairWith(t, settings, settings)
+}
+
+// Same as connectPair, with different settings for the two peers
+func connectPairWith(t *testing.T, s1 ConnectionSettings, s2 ConnectionSettings) (*Connection, *Connection) {
+	t.Helper()
+	for _, s := range []*ConnectionSettings{&s1, &s2} {
+		if s.Signaling == "" {
+			s.Signaling = signalingURL
+		}
+		if s.BufferSize == 0 {
+			s.BufferSize = 1
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	type result struct {
+		c   *Connection
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		c, err := FromSettingsContext(ctx, &s2)
+		res <- result{c, err}
+	}()
+	c1, err := FromSettingsContext(ctx, &s1)
+	r := <-res
+	if err != nil || r.err != nil {
+		t.Fatalf("Cannot connect: %v, %v", err, r.err)
+	}
+	c2 := r.c
+	t.Cleanup(func() {
+		c1.CloseAll()
+		c2.CloseAll()
+	})
+	if c1.Offer {
+		return c1, c2
+	}
+	return c2, c1
+}
@@ -0,0 +1,129 @@
+package connection
+
+import (
+	"github.com/pion/webrtc/v4"
+)
+
+// Kind of state changed by a StateEvent
+type StateKind int
+
+const (
+	StatePeerConnection StateKind = iota
+	StateICE
+	StateSignaling
+	StateDataChannel
+	// the peer stopped or resumed answering the heartbeat
+	StateHeartbeat
+)
+
+func (k StateKind) String() string {
+	switch k {
+	case StatePeerConnection:
+		return "peer connection"
+	case StateICE:
+		return "ICE"
+	case StateSignaling:
+		return "signaling"
+	case StateDataChannel:
+		return "data channel"
+	case StateHeartbeat:
+		return "heartbeat"
+	}
+	return "unknown"
+}
+
+// A state change of a Connection.
+// Only the field matching Kind is set.
+type StateEvent struct {
+	Kind           StateKind
+	PeerConnection webrtc.PeerConnectionState
+	ICE            webrtc.ICEConnectionState
+	Signaling      webrtc.SignalingState
+	DataChannel    webrtc.DataChannelState
+	// Label of the data channel, for StateDataChannel
+	Label string
+	// For StateHeartbeat, true iff the peer stopped answering
+	Unresponsive bool
+}
+
+func (e StateEvent) String() string {
+	switch e.Kind {
+	case StatePeerConnection:
+		return e.Kind.String() + " " + e.PeerConnection.String()
+	case StateICE:
+		return e.Kind.String() + " " + e.ICE.String()
+	case StateSignaling:
+		return e.Kind.String() + " " + e.Signaling.String()
+	case StateDataChannel:
+		return e.Kind.String() + " " + e.Label + " " + e.DataChannel.String()
+	case StateHeartbeat:
+		if e.Unresponsive {
+			return e.Kind.String() + " unresponsive"
+		}
+		return e.Kind.String() + " responsive"
+	}
+	return e.Kind.String()
+}
+
+// Current states of a Connection
+type States struct {
+	PeerConnection webrtc.PeerConnectionState
+	ICE            webrtc.ICEConnectionState
+	Signaling      webrtc.SignalingState
+	// State of the default data channel
+	DataChannel webrtc.DataChannelState
+	// True iff the peer stopped answering the heartbeat
+	Unresponsive bool
+}
+
+// Subscribes to the state changes of the connection.
+// Events are buffered up to size; when a subscriber falls behind its
+// oldest events are dropped, so that pion callbacks never block and the
+// latest state is always delivered.
+// The channel is closed by cancel, or after the final closed state
+// once the connection is closed.
+func (c *Connection) Subscribe(size int) (<-chan StateEvent, func()) {
+	return c.states.subscribe(size)
+}
+
+// Current states of the connection, zero values until the peer connection exists
+func (c *Connection) States() States {
+	c.mu.Lock()
+	peer, dc := c.peer, c.dc
+	c.mu.Unlock()
+	var states States
+	_, states.Unresponsive = c.heartbeatState()
+	if peer == nil {
+		return states
+	}
+	states.PeerConnection = peer.ConnectionState()
+	states.ICE = peer.ICEConnectionState()
+	states.Signaling = peer.SignalingState()
+	if dc != nil {
+		states.DataChannel = dc.ReadyState()
+	}
+	return states
+}
+
+// Sends ev to all the subscribers, without blocking
+func (c *Connection) publish(ev StateEvent) {
+	c.logger().Debug("state changed", "state", ev.String())
+	c.states.publish(ev)
+}
+
+// Publishes the closed state and closes the subscriptions
+func (c *Connection) closeSubscribers() {
+	c.publish(StateEvent{Kind: StatePeerConnection, PeerConnection: webrtc.PeerConnectionStateClosed})
+	c.states.close()
+}
+
+// Publishes the state changes of dc.
+// onClose, if not nil, is called after dc has closed
+func (c *Connection) watchDataChannel(dc *webrtc.DataChannel, onClose func()) {
+	dc.OnClose(func() {
+		c.publish(StateEvent{Kind: StateDataChannel, DataChannel: webrtc.DataChannelStateClosed, Label: dc.Label()})
+		if onClose != nil {
+			onClose()
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Waits for an event matching match on events
+func waitEvent(t *testing.T, events <-chan StateEvent, match func(StateEvent) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("Subscription closed")
+			}
+			if match(ev) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Event not received")
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "subscribe"})
+	states := offerer.States()
+	if states.PeerConnection != webrtc.PeerConnectionStateConnected ||
+		states.ICE != webrtc.ICEConnectionStateConnected ||
+		states.Signaling != webrtc.SignalingStateStable ||
+		states.DataChannel != webrtc.DataChannelStateOpen {
+		t.Errorf("Unexpected states %+v", states)
+	}
+
+	first, _ := offerer.Subscribe(4)
+	second, _ := offerer.Subscribe(4)
+	// never read: must not block the other subscribers
+	stalled, _ := offerer.Subscribe(1)
+	cancelled, cancel := offerer.Subscribe(4)
+	cancel()
+	if _, ok := <-cancelled; ok {
+		t.Errorf("Cancelled subscription should be closed")
+	}
+
+	if _, err := answerer.OpenChannel("watched", nil); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	opened := func(ev StateEvent) bool {
+		return ev.Kind == StateDataChannel && ev.Label == "watched" && ev.DataChannel == webrtc.DataChannelStateOpen
+	}
+	waitEvent(t, first, opened)
+	waitEvent(t, second, opened)
+
+	offerer.CloseAll()
+	closed := func(ev StateEvent) bool {
+		return ev.Kind == StatePeerConnection && ev.PeerConnection == webrtc.PeerConnectionStateClosed
+	}
+	// the final state is delivered even to the stalled subscriber
+	for _, events := range []<-chan StateEvent{first, second, stalled} {
+		waitEvent(t, events, closed)
+		if _, ok := <-events; ok {
+			t.Errorf("Subscription should be closed after the closed state")
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Snapshot of the state of a Connection, see Connection.Stats
+type Stats struct {
+	Timestamp time.Time
+	State     webrtc.PeerConnectionState
+	// Selected ICE candidate pair, nil until ICE has connected
+	Pair      *CandidatePairStats
+	DTLSState webrtc.DTLSTransportState
+	SCTPState webrtc.SCTPTransportState
+	// Round trip time of the last heartbeat, zero if disabled or not measured yet
+	HeartbeatRTT time.Duration
+	// True iff the peer stopped answering the heartbeat
+	Unresponsive bool
+	// Data channels by label, the default one included
+	Channels map[string]ChannelStats
+}
+
+type CandidateStats struct {
+	// host, srflx, prflx or relay
+	Type     webrtc.ICECandidateType
+	Protocol string
+	Address  string
+	Port     int
+}
+
+type CandidatePairStats struct {
+	Local  CandidateStats
+	Remote CandidateStats
+	// Round trip time of the last connectivity check, zero if not measured yet
+	RTT           time.Duration
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+type ChannelStats struct {
+	Label string
+	State webrtc.DataChannelState
+	// Messages are counted in frames (see FrameSize)
+	MessagesSent     uint32
+	MessagesReceived uint32
+	BytesSent        uint64
+	BytesReceived    uint64
+	// Bytes queued by the data channel and not sent yet
+	BufferedAmount uint64
+}
+
+// Collects the statistics of the connection.
+// Can be called at any time, fields not available yet are left empty.
+func (c *Connection) Stats() Stats {
+	stats := Stats{
+		Timestamp: time.Now(),
+		Channels:  make(map[string]ChannelStats),
+	}
+	stats.HeartbeatRTT, stats.Unresponsive = c.heartbeatState()
+	c.mu.Lock()
+	peer, dc := c.peer, c.dc
+	c.mu.Unlock()
+	if peer == nil {
+		return stats
+	}
+	stats.State = peer.ConnectionState()
+	if sctp := peer.SCTP(); sctp != nil {
+		stats.SCTPState = sctp.State()
+		stats.DTLSState = sctp.Transport().State()
+	}
+
+	stats.Pair = c.pairStats()
+	report := peer.GetStats()
+
+	dcs := []*webrtc.DataChannel{dc}
+	c.chmu.Lock()
+	for _, ch := range c.channels {
+		dcs = append(dcs, ch.DataChannel())
+	}
+	c.chmu.Unlock()
+	for _, dc := range dcs {
+		if dc == nil {
+			continue
+		}
+		channel := ChannelStats{
+			Label:          dc.Label(),
+			State:          dc.ReadyState(),
+			BufferedAmount: dc.BufferedAmount(),
+		}
+		if s, ok := report.GetDataChannelStats(dc); ok {
+			channel.MessagesSent = s.MessagesSent
+			channel.MessagesReceived = s.MessagesReceived
+			channel.BytesSent = s.BytesSent
+			channel.BytesReceived = s.BytesReceived
+		}
+		stats.Channels[channel.Label] = channel
+	}
+	return stats
+}
+
+// Statistics of the selected candidate pair, nil if none
+func (c *Connection) pairStats() *CandidatePairStats {
+	selected := c.selectedPair()
+	if selected == nil {
+		return nil
+	}
+	pair := &CandidatePairStats{
+		Local:  candidateStats(selected.Local),
+		Remote: candidateStats(selected.Remote),
+	}
+	if s, ok := c.peer.SCTP().Transport().ICETransport().GetSelectedCandidatePairStats(); ok {
+		pair.RTT = time.Duration(s.CurrentRoundTripTime * float64(time.Second))
+		pair.BytesSent = s.BytesSent
+		pair.BytesReceived = s.BytesReceived
+	}
+	return pair
+}
+
+func candidateStats(candidate *webrtc.ICECandidate) CandidateStats {
+	return CandidateStats{
+		Type:     candidate.Typ,
+		Protocol: candidate.Protocol.String(),
+		Address:  candidate.Address,
+		Port:     int(candidate.Port),
+	}
+}
@@ -0,0 +1,50 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestStats(t *testing.T) {
+	offerer, answerer := connectPair(t, ConnectionSettings{Key: "stats"})
+	if _, err := offerer.OpenChannel("extra", nil); err != nil {
+		t.Fatalf("Cannot open channel: %v", err)
+	}
+	offerer.Send([]byte("ping"))
+	answerer.Recv()
+
+	var stats Stats
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats = offerer.Stats()
+		if stats.Pair != nil && stats.Pair.RTT > 0 && len(stats.Channels) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Incomplete stats: %+v", stats)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if stats.State != webrtc.PeerConnectionStateConnected {
+		t.Errorf("Expected connected, got %v", stats.State)
+	}
+	if stats.DTLSState != webrtc.DTLSTransportStateConnected || stats.SCTPState != webrtc.SCTPTransportStateConnected {
+		t.Errorf("Expected DTLS and SCTP connected, got %v and %v", stats.DTLSState, stats.SCTPState)
+	}
+	if stats.Pair.Local.Type != webrtc.ICECandidateTypeHost || stats.Pair.Local.Address == "" {
+		t.Errorf("Unexpected local candidate %+v", stats.Pair.Local)
+	}
+	if stats.Pair.BytesSent == 0 || stats.Pair.BytesReceived == 0 {
+		t.Errorf("No bytes counted on the candidate pair: %+v", stats.Pair)
+	}
+	data := stats.Channels[DefaultLabel]
+	if data.MessagesSent != 1 || data.BytesSent != uint64(len("ping")+1) {
+		t.Errorf("Unexpected default channel stats %+v", data)
+	}
+	if _, ok := stats.Channels["extra"]; !ok {
+		t.Errorf("Missing stats of the extra channel")
+	}
+}
@@ -0,0 +1,27 @@
+package connection
+
+import (
+	"time"
+
+	"github.com/pion/turn/v4"
+)
+
+// Generates time-limited TURN credentials as described by the TURN REST API
+// (username "<expiry>:<user>", credential base64(HMAC-SHA1(secret, username))).
+// The credentials are valid for ttl, and can be used as
+// TURNUsername and TURNCredential of a ConnectionSettings.
+func TURNRESTCredentials(secret string, user string, ttl time.Duration) (string, string, error) {
+	return turn.GenerateLongTermTURNRESTCredentials(secret, user, ttl)
+}
+
+// Sets TURNUsername and TURNCredential to TURN REST credentials
+// valid for ttl
+func (s *ConnectionSettings) SetTURNSecret(secret string, user string, ttl time.Duration) error {
+	username, credential, err := TURNRESTCredentials(secret, user, ttl)
+	if err != nil {
+		return err
+	}
+	s.TURNUsername = username
+	s.TURNCredential = credential
+	return nil
+}
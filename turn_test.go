@@ -0,0 +1,118 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v4"
+	"github.com/pion/webrtc/v4"
+)
+
+const turnSecret = "turn-secret"
+
+// Starts a TURN server on loopback accepting TURN REST credentials
+func startTURN(t *testing.T) string {
+	udp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen for TURN: %v", err)
+	}
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: "directchan",
+		AuthHandler: turn.LongTermTURNRESTAuthHandler(turnSecret, nil),
+		PacketConnConfigs: []turn.PacketConnConfig{
+			{
+				PacketConn: udp,
+				RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+					RelayAddress: net.ParseIP("127.0.0.1"),
+					Address: "127.0.0.1",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Cannot start TURN server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return "turn:" + udp.LocalAddr().String() + "?transport=udp"
+}
+
+func TestTURNRelayOnly(t *testing.T) {
+	turnURL := startTURN(t)
+	newSettings := func(user string) *ConnectionSettings {
+		s := &ConnectionSettings{
+			Signaling: signalingURL,
+			TURN: turnURL,
+			ICETransportPolicy: webrtc.ICETransportPolicyRelay,
+			Key: "turn",
+			BufferSize: 1,
+		}
+		if err := s.SetTURNSecret(turnSecret, user, time.Minute); err != nil {
+			t.Fatalf("Cannot generate TURN credentials: %v", err)
+		}
+		return s
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	payload := []byte("relayed")
+
+	type result struct {
+		c   *Connection
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		c, err := FromSettingsContext(ctx, newSettings("alice"))
+		res <- result{c, err}
+	}()
+
+	conn2, err := FromSettingsContext(ctx, newSettings("bob"))
+	if err != nil {
+		t.Fatalf("Error while opening conn2: %v", err)
+	}
+	defer conn2.CloseAll()
+	r := <-res
+	if r.err != nil {
+		t.Fatalf("Error while opening conn1: %v", r.err)
+	}
+	conn1 := r.c
+	defer conn1.CloseAll()
+
+	conn1.Send(payload)
+	if info := conn2.Recv(); !slices.Equal(info, payload) {
+		t.Errorf("Expected %s, got %s", payload, info)
+	}
+
+	for _, c := range []*Connection{conn1, conn2} {
+		pair, err := c.peer.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+		if err != nil || pair == nil {
+			t.Fatalf("No selected candidate pair: %v", err)
+		}
+		if pair.Local.Typ != webrtc.ICECandidateTypeRelay {
+			t.Errorf("Expected a relay candidate, got %s", pair.Local.Typ)
+		}
+	}
+}
+
+func TestICEServers(t *testing.T) {
+	s := ConnectionSettings{
+		STUN: []string{"stun:a", "stun:b"},
+		TURN: "turn:c",
+		TURNUsername: "user",
+		TURNCredential: "pass",
+		ICEServers: []webrtc.ICEServer{{URLs: []string{"turn:d"}}},
+	}
+	servers := s.iceServers()
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 ICE servers, got %d", len(servers))
+	}
+	if servers[1].Username != "user" || servers[1].Credential != "pass" {
+		t.Errorf("TURN credentials not set: %v", servers[1])
+	}
+	if len((&ConnectionSettings{}).iceServers()) != 0 {
+		t.Errorf("Expected no ICE servers for empty settings")
+	}
+}
@@ -0,0 +1,197 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// Signaler using the signaling server of server/main.go.
+// Connection process: ws connect -> key -> (OFFER|ANSWER) -> Ready,
+// then the server relays the messages between the two peers.
+type WebSocketSignaler struct {
+	URL string // address of the signaling server ("ws://<ip>:<port>")
+	Key string // channel's identifier
+	// Role requested to the server, RoleAny to take the one left by
+	// the other peer
+	Role Role
+
+	conn *ws.Conn
+	mu   sync.Mutex
+}
+
+var _ Signaler = (*WebSocketSignaler)(nil)
+
+func NewWebSocketSignaler(url string, key string) *WebSocketSignaler {
+	return &WebSocketSignaler{URL: url, Key: key}
+}
+
+// Makes a ws connection with the server and sends the key to it.
+// Returns when the other peer has connected.
+// If ctx is done first, the ws connection is closed and ctx.Err() is returned.
+func (s *WebSocketSignaler) Connect(ctx context.Context) (bool, error) {
+	url := s.URL + "/"
+	if s.Role != RoleAny {
+		url += "?role=" + string(s.Role)
+	}
+	conn, _, err := ws.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return false, err
+	}
+
+	// unblocks the reads below
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	offer, err := s.handshake(conn)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, err
+	}
+	if !stop() {
+		return false, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	return offer, nil
+}
+
+// Sends the key and waits for the role and for the other peer.
+// Returns true iff the role is OFFER
+func (s *WebSocketSignaler) handshake(conn *ws.Conn) (bool, error) {
+	var offer bool
+	err := conn.WriteMessage(ws.TextMessage, []byte(s.Key))
+
+	if err != nil {
+		return offer, err
+	}
+
+	// ROLE
+	_, resp, err := conn.ReadMessage()
+	if err != nil {
+		return offer, err
+	}
+
+	switch string(resp) {
+	case "OFFER":
+		offer = true
+	case "ANSWER":
+		offer = false
+	default:
+		return offer, badResponse(resp)
+	}
+	if (s.Role == RoleDial && !offer) || (s.Role == RoleListen && offer) {
+		// the server predates roles
+		return offer, errors.New("Role " + string(s.Role) + " not honoured by the signaling server")
+	}
+
+	// Ready
+	_, resp, err = conn.ReadMessage()
+	if err != nil {
+		return offer, err
+	}
+	if string(resp) != "Ready" {
+		return offer, badResponse(resp)
+	}
+	return offer, nil
+}
+
+// Error for an unexpected response of the signaling server
+func badResponse(resp []byte) error {
+	if msg, err := DecodeMessage(resp); err == nil && msg.Type == MessageError {
+		return &ServerError{Reason: msg.Error}
+	}
+	return errors.New("Bad response: " + string(resp))
+}
+
+// Error reported by the signaling server before pairing
+type ServerError struct {
+	Reason string
+}
+
+var (
+	// No peer came for the key in time
+	ErrSignalingTimeout = errors.New("Signaling timeout")
+	// The requested role is already taken on the key
+	ErrRoleConflict = errors.New("Role conflict")
+)
+
+func (e *ServerError) Error() string {
+	return "Signaling server error: " + e.Reason
+}
+
+// ErrSignalingTimeout or ErrRoleConflict depending on the reason, if any
+func (e *ServerError) Unwrap() error {
+	switch {
+	case e.Reason == "timeout":
+		return ErrSignalingTimeout
+	case strings.HasPrefix(e.Reason, "role conflict"):
+		return ErrRoleConflict
+	}
+	return nil
+}
+
+// Current ws connection, nil if closed
+func (s *WebSocketSignaler) current() *ws.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn
+}
+
+func (s *WebSocketSignaler) Send(ctx context.Context, msg Message) error {
+	conn := s.current()
+	if conn == nil {
+		return net.ErrClosed
+	}
+	p, err := EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	err = conn.WriteMessage(ws.TextMessage, p)
+	conn.SetWriteDeadline(time.Time{})
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *WebSocketSignaler) Recv() (Message, error) {
+	conn := s.current()
+	if conn == nil {
+		return Message{}, net.ErrClosed
+	}
+	_, p, err := conn.ReadMessage()
+	if err != nil {
+		return Message{}, err
+	}
+	return DecodeMessage(p)
+}
+
+func (s *WebSocketSignaler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}